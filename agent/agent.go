@@ -0,0 +1,241 @@
+// Package agent runs checks on a schedule and keeps their latest results in
+// memory, so a poller can read them over HTTP instead of forking a plugin
+// per check.
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// Job is a named check instance run every Interval.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Command  string
+	Args     []string
+	Check    check.Check
+}
+
+// NewJob creates a job running the named subcommand with the given
+// arguments.
+func NewJob(definitions []*check.Definition, name string, interval time.Duration, command string, args []string) (*Job, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("check %s: interval must be positive", name)
+	}
+	def := check.FindDefinition(definitions, command)
+	if def == nil {
+		return nil, fmt.Errorf("check %s: no such command '%s'", name, command)
+	}
+	c, err := def.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("check %s: %s", name, err)
+	}
+	return &Job{
+		Name:     name,
+		Interval: interval,
+		Command:  command,
+		Args:     args,
+		Check:    c,
+	}, nil
+}
+
+// ParseJob creates a job from a NAME=INTERVAL COMMAND [ARGS...] spec, for
+// example "rootfs=30s disk --crit-level=95".
+func ParseJob(definitions []*check.Definition, spec string) (*Job, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected NAME=INTERVAL COMMAND [ARGS...] got '%s'", spec)
+	}
+	fields := strings.Fields(parts[1])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("expected NAME=INTERVAL COMMAND [ARGS...] got '%s'", spec)
+	}
+	interval, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("check %s: %s", parts[0], err)
+	}
+	return NewJob(definitions, parts[0], interval, fields[1], fields[2:])
+}
+
+// Result is the latest outcome of a job.
+type Result struct {
+	Job       *Job
+	Status    *check.Status
+	CheckedAt time.Time
+	Duration  time.Duration
+}
+
+// Agent schedules jobs and stores their latest results.
+type Agent struct {
+	jobs    []*Job
+	mu      sync.RWMutex
+	results map[string]*Result
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates an agent for the jobs. Job names must be unique.
+func New(jobs []*Job) (*Agent, error) {
+	seen := make(map[string]bool)
+	for _, job := range jobs {
+		if seen[job.Name] {
+			return nil, fmt.Errorf("duplicate check '%s'", job.Name)
+		}
+		seen[job.Name] = true
+	}
+	return &Agent{
+		jobs:    jobs,
+		results: make(map[string]*Result),
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Start runs every job immediately and then on its interval, each in its
+// own goroutine.
+func (a *Agent) Start() {
+	for _, job := range a.jobs {
+		a.wg.Add(1)
+		go a.schedule(job)
+	}
+}
+
+// Stop stops scheduling and waits for running checks to finish.
+func (a *Agent) Stop() {
+	close(a.stop)
+	a.wg.Wait()
+}
+
+func (a *Agent) schedule(job *Job) {
+	defer a.wg.Done()
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		a.store(Run(job))
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) store(result *Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.results[result.Job.Name] = result
+}
+
+// Run runs a job once. A panicking check is reported as UNKNOWN instead of
+// taking the agent down.
+func Run(job *Job) (result *Result) {
+	start := time.Now()
+	result = &Result{Job: job, CheckedAt: start}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Status = check.Unknownf("check panicked: %v", r)
+		}
+		result.Duration = time.Since(start)
+	}()
+	result.Status = job.Check.Run()
+	return result
+}
+
+// Result returns the latest result of the named job.
+func (a *Agent) Result(name string) (*Result, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	result, ok := a.results[name]
+	return result, ok
+}
+
+// Results returns the latest result of every job that has run, sorted by
+// name.
+func (a *Agent) Results() []*Result {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	results := make([]*Result, 0, len(a.results))
+	for _, result := range a.results {
+		results = append(results, result)
+	}
+	sort.Sort(byName(results))
+	return results
+}
+
+type byName []*Result
+
+func (r byName) Len() int           { return len(r) }
+func (r byName) Less(i, j int) bool { return r[i].Job.Name < r[j].Job.Name }
+func (r byName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// RunAll runs every job once, concurrently, and returns their results in
+// job order.
+func RunAll(jobs []*Job) []*Result {
+	results := make([]*Result, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job *Job) {
+			defer wg.Done()
+			results[i] = Run(job)
+		}(i, job)
+	}
+	wg.Wait()
+	return results
+}
+
+// Aggregate combines results into a single status with
+// nagios.NagiosStatus.Aggregate: the worst value wins and the first line
+// lists every check. Messages of checks that are not OK follow as long
+// output, and perfdata is prefixed with the job name.
+func Aggregate(results []*Result) *check.Status {
+	counts := make([]int, 4)
+	statuses := make([]*nagios.NagiosStatus, len(results))
+	var details bytes.Buffer
+	status := &check.Status{}
+	for i, result := range results {
+		counts[result.Status.Value]++
+		first := result.Status.Message
+		if n := strings.Index(first, "\n"); n >= 0 {
+			first = first[:n]
+		}
+		statuses[i] = &nagios.NagiosStatus{
+			Message: fmt.Sprintf("%s %s: %s", result.Job.Name, result.Status.State(), first),
+			Value:   result.Status.Value,
+		}
+		if result.Status.Value != nagios.NAGIOS_OK {
+			fmt.Fprintf(&details, "\n[%s] %s", result.Job.Name, strings.TrimRight(result.Status.Message, "\n"))
+		}
+		for _, p := range result.Status.Perfdata {
+			status.AddPerfdata(prefixPerfdata(result.Job.Name, p))
+		}
+	}
+
+	status.Message = fmt.Sprintf("%d checks, %d warning, %d critical, %d unknown",
+		len(results), counts[nagios.NAGIOS_WARNING], counts[nagios.NAGIOS_CRITICAL], counts[nagios.NAGIOS_UNKNOWN])
+	status.NagiosStatus.Aggregate(statuses)
+	status.Message += details.String()
+	return status
+}
+
+// prefixPerfdata copies p with its label prefixed by the job name and the
+// job added to its labels, so metrics of different jobs stay apart.
+func prefixPerfdata(job string, p *check.Perfdata) *check.Perfdata {
+	prefixed := *p
+	prefixed.Label = job + " " + p.Label
+	if prefixed.Name == "" {
+		prefixed.Name = p.Label
+	}
+	prefixed.Labels = map[string]string{"job": job}
+	for k, v := range p.Labels {
+		prefixed.Labels[k] = v
+	}
+	return &prefixed
+}
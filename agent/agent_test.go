@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// counterDefinition is a check that warns once --warn-level is reached and
+// counts how often it ran.
+var runs = make(chan int, 100)
+
+var counterDefinition = &check.Definition{
+	Name: "counter",
+	Help: "Count runs.",
+	Register: func(flags check.FlagSet) check.Check {
+		warn := check.RangeFlag(flags.Flag("warn-level", "warn range").Default("~:1"))
+		count := 0
+		return check.CheckFunc(func() *check.Status {
+			count++
+			runs <- count
+			status := check.NewStatus(check.Evaluate(float64(count), warn, nil), "counted")
+			status.AddPerfdata(check.NewPerfdata("count", float64(count), ""))
+			return status
+		})
+	},
+}
+
+var panicDefinition = &check.Definition{
+	Name: "panic",
+	Register: func(flags check.FlagSet) check.Check {
+		return check.CheckFunc(func() *check.Status {
+			panic("boom")
+		})
+	},
+}
+
+var definitions = []*check.Definition{counterDefinition, panicDefinition}
+
+func TestParseJob(t *testing.T) {
+	job, err := ParseJob(definitions, "visits=30s counter --warn-level=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Name != "visits" || job.Interval != 30*time.Second || job.Command != "counter" || len(job.Args) != 1 {
+		t.Errorf("unexpected job %+v.", job)
+	}
+
+	for _, spec := range []string{"visits", "visits=30s", "visits=soon counter", "visits=30s nope", "visits=30s counter --bogus", "visits=0s counter"} {
+		if _, err := ParseJob(definitions, spec); err == nil {
+			t.Errorf("spec %q should be invalid.", spec)
+		}
+	}
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	job, _ := ParseJob(definitions, "p=1s panic")
+	result := Run(job)
+	if result.Status.Value != nagios.NAGIOS_UNKNOWN || !strings.Contains(result.Status.Message, "boom") {
+		t.Errorf("panic should be UNKNOWN, status is %v.", result.Status)
+	}
+}
+
+func TestAgentSchedulesAndServes(t *testing.T) {
+	job, err := ParseJob(definitions, "visits=10ms counter --warn-level=~:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New([]*Job{job})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Start()
+	for count := 0; count < 3; {
+		select {
+		case count = <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("check should run on its interval")
+		}
+	}
+	a.Stop()
+
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/checks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []resultJSON
+	json.NewDecoder(response.Body).Decode(&list)
+	response.Body.Close()
+	if len(list) != 1 || list[0].Name != "visits" || list[0].State != "WARNING" {
+		t.Errorf("unexpected results %+v.", list)
+	}
+
+	response, err = http.Get(server.URL + "/checks/visits?format=nagios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	n, _ := response.Body.Read(buf)
+	response.Body.Close()
+	if !strings.HasPrefix(string(buf[:n]), "WARNING: counted | count=") || response.Header.Get("X-Check-Status") != "1" {
+		t.Errorf("unexpected nagios output %q.", buf[:n])
+	}
+
+	response, _ = http.Get(server.URL + "/checks/missing")
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("missing check should be 404, got %d.", response.StatusCode)
+	}
+}
+
+func TestNewRejectsDuplicates(t *testing.T) {
+	one, _ := ParseJob(definitions, "a=1s counter")
+	two, _ := ParseJob(definitions, "a=1s counter")
+	if _, err := New([]*Job{one, two}); err == nil {
+		t.Error("duplicate names should be rejected")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	fixed := func(name string, status *check.Status) *Job {
+		return &Job{Name: name, Check: check.CheckFunc(func() *check.Status { return status })}
+	}
+	full := check.Critical("CheckDisk.\n  / is full")
+	full.AddPerfdata(check.NewPerfdata("/", 99, "%").Metric("capacity", map[string]string{"mount": "/"}))
+	results := RunAll([]*Job{
+		fixed("api", check.Ok("200, 12 bytes")),
+		fixed("rootfs", full),
+	})
+
+	status := Aggregate(results)
+	if status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("expected CRITICAL, status is %v.", status.State())
+	}
+	expected := "CRITICAL: 2 checks, 0 warning, 1 critical, 0 unknown - api OK: 200, 12 bytes - rootfs CRITICAL: CheckDisk. | 'rootfs /'=99%\n[rootfs] CheckDisk.\n  / is full"
+	if status.String() != expected {
+		t.Errorf("expected %q, output is %q.", expected, status.String())
+	}
+	p := status.Perfdata[0]
+	if p.Name != "capacity" || p.Labels["job"] != "rootfs" || p.Labels["mount"] != "/" {
+		t.Errorf("perfdata should keep its metric and gain the job label, is %+v.", p)
+	}
+	if full.Perfdata[0].Label != "/" {
+		t.Error("aggregating should not modify the check perfdata.")
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AcalephStorage/go_check/check"
+)
+
+type resultJSON struct {
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	Status    int       `json:"status"`
+	State     string    `json:"state"`
+	Output    string    `json:"output"`
+	CheckedAt time.Time `json:"checked_at"`
+	Duration  float64   `json:"duration"`
+	Interval  float64   `json:"interval"`
+}
+
+func toJSON(result *Result) *resultJSON {
+	return &resultJSON{
+		Name:      result.Job.Name,
+		Command:   result.Job.Command,
+		Status:    int(result.Status.Value),
+		State:     result.Status.State(),
+		Output:    result.Status.String(),
+		CheckedAt: result.CheckedAt,
+		Duration:  result.Duration.Seconds(),
+		Interval:  result.Job.Interval.Seconds(),
+	}
+}
+
+// ServeHTTP serves the latest results:
+//
+//	GET /checks                 every result as JSON
+//	GET /checks?format=nagios   every result as Nagios text, one per block
+//	GET /checks/NAME            one result as JSON
+//	GET /checks/NAME?format=F   one result in any --output format
+//
+// Single results carry their Nagios status in the X-Check-Status header.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch {
+	case r.URL.Path == "/checks" || r.URL.Path == "/checks/":
+		a.serveAll(w, format)
+	case strings.HasPrefix(r.URL.Path, "/checks/"):
+		a.serveOne(w, strings.TrimPrefix(r.URL.Path, "/checks/"), format)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *Agent) serveAll(w http.ResponseWriter, format string) {
+	results := a.Results()
+	switch format {
+	case "", "json":
+		list := make([]*resultJSON, len(results))
+		for i, result := range results {
+			list[i] = toJSON(result)
+		}
+		writeJSON(w, list)
+	case "nagios":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, result := range results {
+			fmt.Fprintf(w, "[%s] %s\n", result.Job.Name, result.Status.String())
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+	}
+}
+
+func (a *Agent) serveOne(w http.ResponseWriter, name, format string) {
+	result, ok := a.Result(name)
+	if !ok {
+		if a.hasJob(name) {
+			http.Error(w, fmt.Sprintf("check '%s' has not run yet", name), http.StatusServiceUnavailable)
+		} else {
+			http.Error(w, fmt.Sprintf("no such check '%s'", name), http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("X-Check-Status", fmt.Sprint(int(result.Status.Value)))
+
+	if format == "" || format == "json" {
+		writeJSON(w, toJSON(result))
+		return
+	}
+	output := &check.Output{Format: format, Annotations: map[string]string{"job": result.Job.Name}}
+	var buf bytes.Buffer
+	if err := output.Write(&buf, result.Job.Command, result.Status); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == "sensu" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write(buf.Bytes())
+}
+
+func (a *Agent) hasJob(name string) bool {
+	for _, job := range a.jobs {
+		if job.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
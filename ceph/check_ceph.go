@@ -1,123 +1,137 @@
-package main
+package ceph
 
 import (
-	"bytes"
-	"errors"
 	"regexp"
 	"strings"
 	"time"
 
-	"os/exec"
-
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-var (
-	keyring     = kingpin.Flag("keyring", "Path to cephx authentication keyring file").String()
-	monitor     = kingpin.Flag("monitor", "Optional monitor IP").String()
-	cluster     = kingpin.Flag("cluster", "Optional cluster name").String()
-	timeout     = kingpin.Flag("timeout", "Timeout").Default("10").Int()
-	ignoreFlags = kingpin.Flag("ignore-flags", "Optional ceph warning flags to ignore").String()
-	detailed    = kingpin.Flag("detailed", "Show ceph health detail on warns/errors (verbose!)").Bool()
-	osdTree     = kingpin.Flag("osd-tree", "Show OSD tree on warns/errors (verbose!)").Bool()
-)
+// Definition is the ceph subcommand.
+var Definition = &check.Definition{
+	Name:     "ceph",
+	Help:     "Check ceph cluster health.",
+	Register: register,
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkCeph()
+type cephCheck struct {
+	keyring     string
+	monitor     string
+	cluster     string
+	timeout     int
+	ignoreFlags string
+	detailed    bool
+	osdTree     bool
 }
 
-func checkCeph() {
-	output := runCmd("ceph health")
+func register(flags check.FlagSet) check.Check {
+	c := &cephCheck{}
+	flags.Flag("keyring", "Path to cephx authentication keyring file").StringVar(&c.keyring)
+	flags.Flag("monitor", "Optional monitor IP").StringVar(&c.monitor)
+	flags.Flag("cluster", "Optional cluster name").StringVar(&c.cluster)
+	flags.Flag("timeout", "Timeout").Default("10").IntVar(&c.timeout)
+	flags.Flag("ignore-flags", "Optional ceph warning flags to ignore").StringVar(&c.ignoreFlags)
+	flags.Flag("detailed", "Show ceph health detail on warns/errors (verbose!)").BoolVar(&c.detailed)
+	flags.Flag("osd-tree", "Show OSD tree on warns/errors (verbose!)").BoolVar(&c.osdTree)
+	return c
+}
+
+func (c *cephCheck) Run() *check.Status {
+	output, err := c.runCmd("ceph health")
+	if err != nil {
+		return cmdStatus(err)
+	}
 	if !strings.HasPrefix(output, "HEALTH_OK") {
-		output = filterIgnoredWarnings(output)
+		if output, err = c.filterIgnoredWarnings(output); err != nil {
+			return check.Unknown(err)
+		}
 	}
 
 	if strings.HasPrefix(output, "HEALTH_OK") {
-		nagios.Ok(output)
+		return healthStatus(nagios.NAGIOS_OK, output)
 	}
 
-	if *detailed {
-		output = runCmd("ceph health detailed")
+	if c.detailed {
+		if output, err = c.runCmd("ceph health detailed"); err != nil {
+			return cmdStatus(err)
+		}
 	}
 
-	if *osdTree {
-		output += runCmd("ceph osd tree")
+	if c.osdTree {
+		tree, err := c.runCmd("ceph osd tree")
+		if err != nil {
+			return cmdStatus(err)
+		}
+		output += tree
 	}
 
 	if strings.HasPrefix(output, "HEALTH_WARN") {
-		nagios.Warning(output)
+		return healthStatus(nagios.NAGIOS_WARNING, output)
 	} else {
-		nagios.Critical(errors.New(output))
+		return healthStatus(nagios.NAGIOS_CRITICAL, output)
 	}
 }
 
-func runCmd(cmd string) (result string) {
-	if *cluster != "" {
-		cmd += " --cluster=" + *cluster
+// healthStatus reports the health as 0 (HEALTH_OK), 1 (HEALTH_WARN) or 2 (HEALTH_ERR).
+func healthStatus(value nagios.NagiosStatusVal, output string) *check.Status {
+	status := check.NewStatus(value, output)
+	status.AddPerfdata(check.NewPerfdata("health", float64(value), "").Thresholds(check.MustParseRange("0"), check.MustParseRange("1")).Bounds(0, 2))
+	return status
+}
+
+func cmdStatus(err error) *check.Status {
+	if err == check.ErrTimeout {
+		return check.Critical(err.Error())
 	}
-	if *keyring != "" {
-		cmd += " -k " + *keyring
+	return check.Unknown(err)
+}
+
+func (c *cephCheck) runCmd(cmd string) (string, error) {
+	if c.cluster != "" {
+		cmd += " --cluster=" + c.cluster
 	}
-	if *monitor != "" {
-		cmd += " -m " + *monitor
+	if c.keyring != "" {
+		cmd += " -k " + c.keyring
 	}
-
-	command := strings.Split(cmd, " ")
-	cephCmd := exec.Command(command[0], command[1:]...)
-	var out bytes.Buffer
-	cephCmd.Stdout = &out
-	cephCmd.Stderr = &out
-
-	if err := cephCmd.Start(); err != nil {
-		nagios.Unknown(err.Error())
+	if c.monitor != "" {
+		cmd += " -m " + c.monitor
 	}
 
-	done := make(chan error)
-	go func() {
-		done <- cephCmd.Wait()
-	}()
-
-	select {
-	case <-time.After(time.Duration(*timeout) * time.Second):
-		nagios.Critical(errors.New("Execution timed out"))
-	case err := <-done:
-		if err != nil {
-			nagios.Unknown(err.Error())
-		}
-	}
-	return out.String()
+	cephCmd := check.ParseCommand(cmd)
+	cephCmd.Timeout = time.Duration(c.timeout) * time.Second
+	cephCmd.Stderr = true
+	return cephCmd.Run()
 }
 
-func filterIgnoredWarnings(result string) string {
+func (c *cephCheck) filterIgnoredWarnings(result string) (string, error) {
 	// remove HEALTH_WARN
 	r := strings.Replace(result, "HEALTH_WARN", "", -1)
 
 	// remove flag set
 	rxp, err := regexp.Compile("\\ ?flag\\(s\\) set")
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return "", err
 	}
 	r = rxp.ReplaceAllString(r, "")
 
 	// remove new lines
 	r = strings.Replace(r, "\n", "", -1)
 
-	for _, flag := range strings.Split(*ignoreFlags, ",") {
+	for _, flag := range strings.Split(c.ignoreFlags, ",") {
 		exp := ",?" + flag + ",?"
 		rxp, err := regexp.Compile(exp)
 		if err != nil {
-			nagios.Unknown(err.Error())
+			return "", err
 		}
 		r = rxp.ReplaceAllString(r, "")
 	}
 
 	if len(r) == 0 {
-		return strings.Replace(result, "HEALTH_WARN", "HEALTH_OK", -1)
+		return strings.Replace(result, "HEALTH_WARN", "HEALTH_OK", -1), nil
 	} else {
-		return result
+		return result, nil
 	}
 
 }
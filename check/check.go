@@ -0,0 +1,61 @@
+// Package check is the shared library behind the go_check plugins. A check
+// implements Check and returns a Status instead of exiting the process, so it
+// can be unit tested and reused by in-house checks.
+package check
+
+import (
+	"fmt"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+// Check is a single Nagios check.
+type Check interface {
+	Run() *Status
+}
+
+// CheckFunc adapts an ordinary function to the Check interface.
+type CheckFunc func() *Status
+
+// Run calls f().
+func (f CheckFunc) Run() *Status {
+	return f()
+}
+
+// NewStatus creates a status with the given value and message.
+func NewStatus(value nagios.NagiosStatusVal, message string) *Status {
+	status := &Status{}
+	status.Value = value
+	status.Message = message
+	return status
+}
+
+// Ok creates an OK status.
+func Ok(message string) *Status {
+	return NewStatus(nagios.NAGIOS_OK, message)
+}
+
+// Warning creates a WARNING status.
+func Warning(message string) *Status {
+	return NewStatus(nagios.NAGIOS_WARNING, message)
+}
+
+// Critical creates a CRITICAL status.
+func Critical(message string) *Status {
+	return NewStatus(nagios.NAGIOS_CRITICAL, message)
+}
+
+// Unknown creates an UNKNOWN status from an error.
+func Unknown(err error) *Status {
+	return NewStatus(nagios.NAGIOS_UNKNOWN, err.Error())
+}
+
+// Unknownf creates an UNKNOWN status from a formatted message.
+func Unknownf(format string, args ...interface{}) *Status {
+	return NewStatus(nagios.NAGIOS_UNKNOWN, fmt.Sprintf(format, args...))
+}
+
+// Exit runs the check and exits with its status.
+func Exit(c Check) {
+	ExitWithStatus(c.Run())
+}
@@ -0,0 +1,25 @@
+package check
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+func TestCheckFunc(t *testing.T) {
+	var c Check = CheckFunc(func() *Status {
+		return Warning("almost full")
+	})
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_WARNING || status.Message != "almost full" {
+		t.Error("check should return its status:", status)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	status := Unknown(errors.New("no such file"))
+	if status.Value != nagios.NAGIOS_UNKNOWN || status.String() != "UNKNOWN: no such file" {
+		t.Error("status should be UNKNOWN:", status)
+	}
+}
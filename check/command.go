@@ -0,0 +1,70 @@
+package check
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrTimeout is returned when a command does not finish within its timeout.
+var ErrTimeout = errors.New("Execution timed out")
+
+// Command is an external program run by a check.
+type Command struct {
+	Name string
+	Args []string
+	// Timeout kills the command when exceeded. Zero waits indefinitely.
+	Timeout time.Duration
+	// Stderr captures standard error into the output as well.
+	Stderr bool
+}
+
+// NewCommand creates a command with no timeout.
+func NewCommand(name string, args ...string) *Command {
+	return &Command{
+		Name: name,
+		Args: args,
+	}
+}
+
+// ParseCommand splits a space separated command line into a command.
+func ParseCommand(command string) *Command {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return &Command{}
+	}
+	return NewCommand(fields[0], fields[1:]...)
+}
+
+// Run runs the command and returns its output.
+func (c *Command) Run() (string, error) {
+	cmd := exec.Command(c.Name, c.Args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if c.Stderr {
+		cmd.Stderr = &out
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	if c.Timeout <= 0 {
+		err := cmd.Wait()
+		return out.String(), err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-time.After(c.Timeout):
+		cmd.Process.Kill()
+		return "", ErrTimeout
+	case err := <-done:
+		return out.String(), err
+	}
+}
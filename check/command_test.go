@@ -0,0 +1,27 @@
+package check
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandRun(t *testing.T) {
+	out, err := NewCommand("echo", "hello").Run()
+	if err != nil || out != "hello\n" {
+		t.Errorf("expected output hello, output is %q (%v).", out, err)
+	}
+}
+
+func TestCommandRunFailure(t *testing.T) {
+	if _, err := NewCommand("false").Run(); err == nil {
+		t.Error("failing command should return an error")
+	}
+}
+
+func TestCommandRunTimeout(t *testing.T) {
+	cmd := ParseCommand("sleep 5")
+	cmd.Timeout = 50 * time.Millisecond
+	if _, err := cmd.Run(); err != ErrTimeout {
+		t.Errorf("expected timeout, error is %v.", err)
+	}
+}
@@ -0,0 +1,41 @@
+package check
+
+import (
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+)
+
+// FlagSet is where a check declares its flags. Both *kingpin.Application
+// and *kingpin.CmdClause satisfy it.
+type FlagSet interface {
+	Flag(name, help string) *kingpin.FlagClause
+}
+
+// Definition describes a check that can be run as a go_check subcommand.
+type Definition struct {
+	Name string
+	Help string
+	// Register declares the check flags and returns the check they
+	// configure. The check must only be run once the flags are parsed.
+	Register func(flags FlagSet) Check
+}
+
+// Parse creates a check configured from its command line arguments, as
+// they would follow the subcommand name.
+func (d *Definition) Parse(args []string) (Check, error) {
+	app := kingpin.New(d.Name, d.Help)
+	c := d.Register(app)
+	if _, err := app.Parse(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FindDefinition returns the definition with the given name, or nil.
+func FindDefinition(definitions []*Definition, name string) *Definition {
+	for _, def := range definitions {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
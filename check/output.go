@@ -0,0 +1,81 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Formatter writes the status of the named check to w.
+type Formatter func(w io.Writer, name string, status *Status, annotations map[string]string) error
+
+// Formatters are the output formats selectable with --output.
+var Formatters = map[string]Formatter{
+	"nagios":     formatNagios,
+	"prometheus": formatPrometheus,
+	"sensu":      formatSensu,
+}
+
+// Output holds the output flags shared by every check.
+type Output struct {
+	Format      string
+	Annotations map[string]string
+	// TextfileDir, when set, also receives the status in the Prometheus
+	// exposition format as <TextfileName>.prom.
+	TextfileDir  string
+	TextfileName string
+}
+
+// OutputFlags declares the shared output flags.
+func OutputFlags(flags FlagSet) *Output {
+	o := &Output{Annotations: make(map[string]string)}
+	flags.Flag("output", fmt.Sprintf("Output format (%s)", strings.Join(formatNames(), ", "))).Default("nagios").StringVar(&o.Format)
+	flags.Flag("annotation", "Extra KEY=VALUE annotation added to structured output and Prometheus labels").StringMapVar(&o.Annotations)
+	flags.Flag("textfile-dir", "Also write Prometheus metrics to this node_exporter textfile collector directory").StringVar(&o.TextfileDir)
+	flags.Flag("textfile-name", "File name, without .prom, in the textfile directory (defaults to go_check_<check>)").StringVar(&o.TextfileName)
+	return o
+}
+
+// Write writes the status of the named check in the selected format, after
+// updating the textfile if one is configured.
+func (o *Output) Write(w io.Writer, name string, status *Status) error {
+	format, ok := Formatters[o.Format]
+	if !ok {
+		return fmt.Errorf("unknown output format '%s'", o.Format)
+	}
+	if o.TextfileDir != "" {
+		file := o.TextfileName
+		if file == "" {
+			file = prometheusPrefix + "_" + name
+		}
+		if err := WriteTextfile(o.TextfileDir, file, name, status, o.Annotations); err != nil {
+			return err
+		}
+	}
+	return format(w, name, status, o.Annotations)
+}
+
+// Exit writes the status of the named check and exits with the status
+// value.
+func (o *Output) Exit(name string, status *Status) {
+	if err := o.Write(os.Stdout, name, status); err != nil {
+		ExitWithStatus(Unknown(err))
+	}
+	os.Exit(int(status.Value))
+}
+
+func formatNagios(w io.Writer, name string, status *Status, annotations map[string]string) error {
+	_, err := fmt.Fprintln(w, status.String())
+	return err
+}
+
+func formatNames() []string {
+	names := make([]string, 0, len(Formatters))
+	for name := range Formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,109 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Perfdata is a single Nagios performance data metric, rendered as
+// 'label'=value[UOM];[warn];[crit];[min];[max]
+type Perfdata struct {
+	Label string
+	Value float64
+	UOM   string
+	Warn  *Range
+	Crit  *Range
+	Min   *float64
+	Max   *float64
+	// Name and Labels identify the metric in structured outputs such as
+	// Prometheus. Name defaults to the label.
+	Name   string
+	Labels map[string]string
+}
+
+// NewPerfdata creates a metric with no thresholds and no bounds.
+func NewPerfdata(label string, value float64, uom string) *Perfdata {
+	return &Perfdata{
+		Label: label,
+		Value: value,
+		UOM:   uom,
+	}
+}
+
+// Thresholds sets the warn and crit thresholds of the metric.
+func (p *Perfdata) Thresholds(warn, crit *Range) *Perfdata {
+	p.Warn = warn
+	p.Crit = crit
+	return p
+}
+
+// Bounds sets the minimum and maximum values of the metric.
+func (p *Perfdata) Bounds(min, max float64) *Perfdata {
+	p.Min = &min
+	p.Max = &max
+	return p
+}
+
+// Minimum sets only the minimum value of the metric.
+func (p *Perfdata) Minimum(min float64) *Perfdata {
+	p.Min = &min
+	return p
+}
+
+// Metric sets the structured name and labels of the metric.
+func (p *Perfdata) Metric(name string, labels map[string]string) *Perfdata {
+	p.Name = name
+	p.Labels = labels
+	return p
+}
+
+func (p *Perfdata) String() string {
+	fields := []string{
+		formatFloat(p.Value) + p.UOM,
+		p.Warn.String(),
+		p.Crit.String(),
+		formatBound(p.Min),
+		formatBound(p.Max),
+	}
+	// trailing empty fields may be dropped
+	last := len(fields)
+	for last > 1 && fields[last-1] == "" {
+		last--
+	}
+	return fmt.Sprintf("%s=%s", quoteLabel(p.Label), strings.Join(fields[:last], ";"))
+}
+
+// FormatPerfdata joins the metrics into a single perfdata section.
+func FormatPerfdata(perfdata []*Perfdata) string {
+	metrics := make([]string, len(perfdata))
+	for i, p := range perfdata {
+		metrics[i] = p.String()
+	}
+	return strings.Join(metrics, " ")
+}
+
+func quoteLabel(label string) string {
+	label = strings.Replace(label, "'", "''", -1)
+	if strings.ContainsAny(label, " ='") {
+		return "'" + label + "'"
+	}
+	return label
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 6, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func formatBound(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return formatFloat(*f)
+}
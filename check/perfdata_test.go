@@ -0,0 +1,43 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+func TestPerfdataString(t *testing.T) {
+	cases := map[string]*Perfdata{
+		"total=23.5%;80;90;0;100":  NewPerfdata("total", 23.5, "%").Thresholds(MustParseRange("80"), MustParseRange("90")).Bounds(0, 100),
+		"load1=0.25;;;0":           NewPerfdata("load1", 0.25, "").Minimum(0),
+		"time=1s":                  NewPerfdata("time", 1, "s"),
+		"offset=-2ms;@-1:1;-10:10": NewPerfdata("offset", -2, "ms").Thresholds(MustParseRange("@-1:1"), MustParseRange("-10:10")),
+		"'/ used'=12KB;;;0;20":     NewPerfdata("/ used", 12, "KB").Bounds(0, 20),
+		"'it''s'=0":                NewPerfdata("it's", -0.0000001, ""),
+	}
+	for expected, perfdata := range cases {
+		if actual := perfdata.String(); actual != expected {
+			t.Errorf("expected perfdata %s, perfdata is %s.", expected, actual)
+		}
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	status := &Status{}
+	status.Value = nagios.NAGIOS_WARNING
+	status.Message = "CheckDisk.\n  /dev/sda1 | 85%"
+	status.AddPerfdata(NewPerfdata("/", 85, "%"), NewPerfdata("/mnt", 10, "%"))
+
+	expected := "WARNING: CheckDisk. | /=85% /mnt=10%\n  /dev/sda1 / 85%"
+	if actual := status.String(); actual != expected {
+		t.Errorf("expected output %q, output is %q.", expected, actual)
+	}
+}
+
+func TestStatusStringWithoutPerfdata(t *testing.T) {
+	status := &Status{}
+	status.Message = "all good"
+	if actual := status.String(); actual != "OK: all good" {
+		t.Errorf("expected output without perfdata, output is %q.", actual)
+	}
+}
@@ -0,0 +1,118 @@
+package check
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Procfs locates the proc and sys filesystems read by a check. Pointing
+// them at /host/proc and /host/sys lets a check running in a container
+// monitor its host, and pointing them at a fixture tree lets it be tested.
+type Procfs struct {
+	ProcRoot string
+	SysRoot  string
+}
+
+// DefaultProcfs is the proc and sys filesystems of the running system.
+var DefaultProcfs = &Procfs{ProcRoot: "/proc", SysRoot: "/sys"}
+
+// ProcfsFlags declares the --proc-root and --sys-root flags. Their defaults
+// can be overridden with GO_CHECK_PROC_ROOT and GO_CHECK_SYS_ROOT.
+func ProcfsFlags(flags FlagSet) *Procfs {
+	p := &Procfs{}
+	flags.Flag("proc-root", "Mount point of the proc filesystem").Default(DefaultProcfs.ProcRoot).OverrideDefaultFromEnvar("GO_CHECK_PROC_ROOT").StringVar(&p.ProcRoot)
+	flags.Flag("sys-root", "Mount point of the sys filesystem").Default(DefaultProcfs.SysRoot).OverrideDefaultFromEnvar("GO_CHECK_SYS_ROOT").StringVar(&p.SysRoot)
+	return p
+}
+
+// Proc returns the path of a file under the proc root, such as
+// Proc("self", "mountinfo").
+func (p *Procfs) Proc(elem ...string) string {
+	return filepath.Join(append([]string{p.ProcRoot}, elem...)...)
+}
+
+// Sys returns the path of a file under the sys root.
+func (p *Procfs) Sys(elem ...string) string {
+	return filepath.Join(append([]string{p.SysRoot}, elem...)...)
+}
+
+// ReadProc reads a file under the proc root.
+func (p *Procfs) ReadProc(elem ...string) (string, error) {
+	data, err := ioutil.ReadFile(p.Proc(elem...))
+	return string(data), err
+}
+
+// ReadSys reads a file under the sys root.
+func (p *Procfs) ReadSys(elem ...string) (string, error) {
+	data, err := ioutil.ReadFile(p.Sys(elem...))
+	return string(data), err
+}
+
+// BootTime returns the btime of /proc/stat, the boot time in seconds since
+// the epoch.
+func (p *Procfs) BootTime() (int64, error) {
+	file, err := os.Open(p.Proc("stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no btime in %s", p.Proc("stat"))
+}
+
+// OnlineCPUs returns the number of online cpus from
+// /sys/devices/system/cpu/online, or by counting the processors of
+// /proc/cpuinfo when sysfs is not available.
+func (p *Procfs) OnlineCPUs() (int, error) {
+	if online, err := p.ReadSys("devices", "system", "cpu", "online"); err == nil {
+		return countCPUList(strings.TrimSpace(online))
+	}
+	cpuinfo, err := p.ReadProc("cpuinfo")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		if fields := strings.SplitN(line, ":", 2); strings.TrimSpace(fields[0]) == "processor" {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no processor in %s", p.Proc("cpuinfo"))
+	}
+	return count, nil
+}
+
+// countCPUList counts the cpus of a list such as 0-3,8,10-11.
+func countCPUList(list string) (int, error) {
+	count := 0
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpu list '%s'", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return 0, fmt.Errorf("invalid cpu list '%s'", list)
+			}
+		}
+		count += last - first + 1
+	}
+	return count, nil
+}
@@ -0,0 +1,49 @@
+package check
+
+import (
+	"os"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+)
+
+func TestProcfsFlags(t *testing.T) {
+	app := kingpin.New("test", "")
+	procfs := ProcfsFlags(app)
+	if _, err := app.Parse([]string{"--proc-root=/host/proc"}); err != nil {
+		t.Fatal(err)
+	}
+	if procfs.Proc("self", "mountinfo") != "/host/proc/self/mountinfo" || procfs.Sys("block") != "/sys/block" {
+		t.Errorf("unexpected paths %s and %s.", procfs.Proc("self", "mountinfo"), procfs.Sys("block"))
+	}
+
+	os.Setenv("GO_CHECK_SYS_ROOT", "/host/sys")
+	defer os.Unsetenv("GO_CHECK_SYS_ROOT")
+	app = kingpin.New("test", "")
+	procfs = ProcfsFlags(app)
+	if _, err := app.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if procfs.ProcRoot != "/proc" || procfs.SysRoot != "/host/sys" {
+		t.Errorf("expected /proc and /host/sys, roots are %s and %s.", procfs.ProcRoot, procfs.SysRoot)
+	}
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	// there is no sysfs fixture, so the processors of cpuinfo are counted
+	cpus, err := (&Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/sys"}).OnlineCPUs()
+	if err != nil || cpus != 2 {
+		t.Errorf("expected 2 cpus, got %d, %v.", cpus, err)
+	}
+
+	for list, expected := range map[string]int{"0": 1, "0-3": 4, "0-3,8,10-11": 7} {
+		if count, err := countCPUList(list); err != nil || count != expected {
+			t.Errorf("expected %d cpus in %s, got %d, %v.", expected, list, count, err)
+		}
+	}
+	for _, list := range []string{"", "a", "3-1", "0-"} {
+		if _, err := countCPUList(list); err == nil {
+			t.Errorf("cpu list %q should be invalid.", list)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const prometheusPrefix = "go_check"
+
+// prometheusUnits maps perfdata units to a base unit suffix and the factor
+// converting the value to it.
+var prometheusUnits = map[string]struct {
+	suffix string
+	factor float64
+}{
+	"%":  {"percent", 1},
+	"s":  {"seconds", 1},
+	"ms": {"seconds", 1e-3},
+	"us": {"seconds", 1e-6},
+	"B":  {"bytes", 1},
+	"KB": {"bytes", 1 << 10},
+	"MB": {"bytes", 1 << 20},
+	"GB": {"bytes", 1 << 30},
+	"TB": {"bytes", 1 << 40},
+}
+
+var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_]+")
+
+type prometheusSample struct {
+	labels string
+	value  float64
+}
+
+type prometheusFamily struct {
+	name    string
+	help    string
+	samples []prometheusSample
+}
+
+func formatPrometheus(w io.Writer, name string, status *Status, annotations map[string]string) error {
+	var families []*prometheusFamily
+	byName := make(map[string]*prometheusFamily)
+	add := func(metric, help string, labels map[string]string, value float64) {
+		family, ok := byName[metric]
+		if !ok {
+			family = &prometheusFamily{name: metric, help: help}
+			byName[metric] = family
+			families = append(families, family)
+		}
+		family.samples = append(family.samples, prometheusSample{formatLabels(annotations, labels), value})
+	}
+
+	add(prometheusPrefix+"_state", "Nagios state of the check (0=OK, 1=WARNING, 2=CRITICAL, 3=UNKNOWN).",
+		map[string]string{"check": name}, float64(status.Value))
+	for _, p := range status.Perfdata {
+		metric, value := prometheusMetric(name, p)
+		add(metric, "", p.Labels, value)
+	}
+
+	var buf bytes.Buffer
+	for _, family := range families {
+		if family.help != "" {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", family.name, family.help)
+		}
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", family.name)
+		for _, sample := range family.samples {
+			fmt.Fprintf(&buf, "%s%s %s\n", family.name, sample.labels, strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// prometheusMetric names a perfdata metric go_check_<check>_<name>_<unit>
+// and converts its value to the base unit.
+func prometheusMetric(check string, p *Perfdata) (string, float64) {
+	name := p.Name
+	if name == "" {
+		name = p.Label
+	}
+	parts := []string{prometheusPrefix, check, name}
+	value := p.Value
+	if unit, ok := prometheusUnits[p.UOM]; ok {
+		parts = append(parts, unit.suffix)
+		value *= unit.factor
+	}
+	metric := invalidMetricChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+	return strings.Trim(metric, "_"), value
+}
+
+func formatLabels(sets ...map[string]string) string {
+	merged := make(map[string]string)
+	for _, labels := range sets {
+		for k, v := range labels {
+			merged[invalidMetricChars.ReplaceAllString(k, "_")] = v
+		}
+	}
+	if len(merged) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", k, escapeLabelValue(merged[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return strings.Replace(value, `"`, `\"`, -1)
+}
+
+// WriteTextfile atomically writes the status of the named check in the
+// Prometheus exposition format to <dir>/<file>.prom, for the node_exporter
+// textfile collector.
+func WriteTextfile(dir, file, name string, status *Status, annotations map[string]string) error {
+	tmp, err := ioutil.TempFile(dir, "."+file)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := formatPrometheus(tmp, name, status, annotations); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, file+".prom"))
+}
@@ -0,0 +1,79 @@
+package check
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+func sampleDiskStatus() *Status {
+	status := NewStatus(nagios.NAGIOS_WARNING, "CheckDisk.")
+	status.AddPerfdata(
+		NewPerfdata("/", 85, "%").Metric("capacity", map[string]string{"mount": "/"}),
+		NewPerfdata("/ used", 2, "KB").Metric("used", map[string]string{"mount": "/"}),
+		NewPerfdata("/mnt", 10, "%").Metric("capacity", map[string]string{"mount": "/mnt"}),
+		NewPerfdata("offset", 12.5, "ms"),
+	)
+	return status
+}
+
+func TestFormatPrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	if err := formatPrometheus(&buf, "disk", sampleDiskStatus(), map[string]string{"env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP go_check_state Nagios state of the check (0=OK, 1=WARNING, 2=CRITICAL, 3=UNKNOWN).
+# TYPE go_check_state gauge
+go_check_state{check="disk",env="prod"} 1
+# TYPE go_check_disk_capacity_percent gauge
+go_check_disk_capacity_percent{env="prod",mount="/"} 85
+go_check_disk_capacity_percent{env="prod",mount="/mnt"} 10
+# TYPE go_check_disk_used_bytes gauge
+go_check_disk_used_bytes{env="prod",mount="/"} 2048
+# TYPE go_check_disk_offset_seconds gauge
+go_check_disk_offset_seconds{env="prod"} 0.0125
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s", buf.String())
+	}
+}
+
+func TestFormatLabelsEscaping(t *testing.T) {
+	labels := formatLabels(map[string]string{"path": "a\"b\\c\nd", "bad-key": "x"})
+	if labels != `{bad_key="x",path="a\"b\\c\nd"}` {
+		t.Errorf("unexpected labels %s.", labels)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := &Output{Format: "nagios", TextfileDir: dir}
+	var buf bytes.Buffer
+	if err := output.Write(&buf, "disk", sampleDiskStatus()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go_check_disk.prom"))
+	if err != nil {
+		t.Fatal("textfile should be written:", err)
+	}
+	if !bytes.Contains(data, []byte(`go_check_state{check="disk"} 1`)) {
+		t.Errorf("textfile should contain the state gauge:\n%s", data)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("temporary files should be cleaned up, found %d files.", len(files))
+	}
+	if buf.String() == "" {
+		t.Error("nagios output should still be written")
+	}
+}
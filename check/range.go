@@ -0,0 +1,157 @@
+package check
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+)
+
+// Range is a threshold range following the Nagios plugin guidelines:
+//
+//	10      alert if < 0 or > 10
+//	10:     alert if < 10
+//	~:10    alert if > 10
+//	10:20   alert if < 10 or > 20
+//	@10:20  alert if >= 10 and <= 20
+//
+// Both ends are inclusive: a value equal to an end is inside the range. The
+// zero Range is unset and never alerts.
+type Range struct {
+	Start  float64
+	End    float64
+	Inside bool
+	spec   string
+}
+
+// ParseRange parses a Nagios threshold range.
+func ParseRange(spec string) (*Range, error) {
+	r := &Range{}
+	if err := r.Set(spec); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MustParseRange is like ParseRange but panics if the range is invalid.
+func MustParseRange(spec string) *Range {
+	r, err := ParseRange(spec)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// RangeFlag binds a kingpin flag to a threshold range.
+func RangeFlag(flag *kingpin.FlagClause) *Range {
+	r := &Range{}
+	flag.SetValue(r)
+	return r
+}
+
+// LowRangeFlag binds a kingpin flag to a threshold range for a value where
+// lower is worse, such as free memory. A bare number N is read as N:, which
+// alerts below N, so levels given before ranges were accepted keep their
+// meaning.
+func LowRangeFlag(flag *kingpin.FlagClause) *Range {
+	r := &Range{}
+	flag.SetValue(lowRange{r})
+	return r
+}
+
+type lowRange struct {
+	*Range
+}
+
+func (r lowRange) Set(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if _, err := strconv.ParseFloat(spec, 64); err == nil {
+		spec += ":"
+	}
+	return r.Range.Set(spec)
+}
+
+// Set parses spec into the range. It implements kingpin.Value.
+func (r *Range) Set(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		*r = Range{}
+		return nil
+	}
+
+	parsed := Range{Start: 0, End: math.Inf(1), spec: spec}
+	body := spec
+	if strings.HasPrefix(body, "@") {
+		parsed.Inside = true
+		body = body[1:]
+	}
+	if body == "" || body == ":" {
+		return fmt.Errorf("empty range in %q", spec)
+	}
+
+	start, end := "", body
+	if i := strings.Index(body, ":"); i >= 0 {
+		start, end = body[:i], body[i+1:]
+	}
+
+	var err error
+	switch start {
+	case "":
+	case "~":
+		parsed.Start = math.Inf(-1)
+	default:
+		if parsed.Start, err = strconv.ParseFloat(start, 64); err != nil {
+			return fmt.Errorf("invalid range start in %q", spec)
+		}
+	}
+	if end != "" {
+		if parsed.End, err = strconv.ParseFloat(end, 64); err != nil {
+			return fmt.Errorf("invalid range end in %q", spec)
+		}
+	}
+	if parsed.Start > parsed.End {
+		return fmt.Errorf("range start is greater than end in %q", spec)
+	}
+
+	*r = parsed
+	return nil
+}
+
+// IsSet reports whether a range has been configured.
+func (r *Range) IsSet() bool {
+	return r != nil && r.spec != ""
+}
+
+// Alert reports whether value triggers the range.
+func (r *Range) Alert(value float64) bool {
+	if !r.IsSet() {
+		return false
+	}
+	inside := value >= r.Start && value <= r.End
+	if r.Inside {
+		return inside
+	}
+	return !inside
+}
+
+func (r *Range) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.spec
+}
+
+// Evaluate returns the state of value against the warn and crit ranges.
+func Evaluate(value float64, warn, crit *Range) nagios.NagiosStatusVal {
+	switch {
+	case crit.Alert(value):
+		return nagios.NAGIOS_CRITICAL
+	case warn.Alert(value):
+		return nagios.NAGIOS_WARNING
+	default:
+		return nagios.NAGIOS_OK
+	}
+}
@@ -0,0 +1,94 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+func TestRangeAlert(t *testing.T) {
+	cases := []struct {
+		spec  string
+		value float64
+		alert bool
+	}{
+		{"10", -1, true},
+		{"10", 0, false},
+		{"10", 10, false},
+		{"10", 10.5, true},
+		{"10:", 9.9, true},
+		{"10:", 10, false},
+		{"10:", 1e9, false},
+		{"~:10", -1e9, false},
+		{"~:10", 11, true},
+		{"10:20", 9, true},
+		{"10:20", 15, false},
+		{"10:20", 21, true},
+		{"@10:20", 9, false},
+		{"@10:20", 10, true},
+		{"@10:20", 20, true},
+		{"@10:20", 21, false},
+		{"-5:5", -5, false},
+		{"-5:5", -6, true},
+		{"", 1e9, false},
+	}
+	for _, c := range cases {
+		r, err := ParseRange(c.spec)
+		if err != nil {
+			t.Errorf("range %q should be valid: %v", c.spec, err)
+			continue
+		}
+		if r.Alert(c.value) != c.alert {
+			t.Errorf("range %q with value %v: expected alert %v.", c.spec, c.value, c.alert)
+		}
+	}
+}
+
+func TestRangeInvalid(t *testing.T) {
+	for _, spec := range []string{"abc", "20:10", "1:x", "@", "~"} {
+		if _, err := ParseRange(spec); err == nil {
+			t.Errorf("range %q should be invalid.", spec)
+		}
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	if s := MustParseRange("@10:20").String(); s != "@10:20" {
+		t.Errorf("expected range @10:20, range is %s.", s)
+	}
+	var unset *Range
+	if unset.String() != "" || unset.IsSet() {
+		t.Error("nil range should be unset")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	warn := MustParseRange("80")
+	crit := MustParseRange("90")
+	if Evaluate(50, warn, crit) != nagios.NAGIOS_OK {
+		t.Error("status should be OK")
+	}
+	if Evaluate(85, warn, crit) != nagios.NAGIOS_WARNING {
+		t.Error("status should be WARNING")
+	}
+	if Evaluate(95, warn, crit) != nagios.NAGIOS_CRITICAL {
+		t.Error("status should be CRITICAL")
+	}
+	if Evaluate(95, nil, nil) != nagios.NAGIOS_OK {
+		t.Error("unset ranges should never alert")
+	}
+}
+
+func TestLowRange(t *testing.T) {
+	for spec, expected := range map[string]string{"30": "30:", " 15 ": "15:", "30:": "30:", "10:20": "10:20", "@~:5": "@~:5"} {
+		r := &Range{}
+		if err := (lowRange{r}).Set(spec); err != nil || r.String() != expected {
+			t.Errorf("expected %q to read as %q, got %q, %v.", spec, expected, r.String(), err)
+		}
+	}
+	r := &Range{}
+	lowRange{r}.Set("30")
+	if r.Alert(92) || !r.Alert(20) {
+		t.Error("a bare low level should alert below it only.")
+	}
+}
@@ -0,0 +1,46 @@
+package check
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// sensuResult is a Sensu check result.
+type sensuResult struct {
+	Name        string            `json:"name"`
+	Status      int               `json:"status"`
+	Output      string            `json:"output"`
+	Metrics     []sensuMetric     `json:"metrics,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type sensuMetric struct {
+	Name  string   `json:"name"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit,omitempty"`
+	Warn  string   `json:"warn,omitempty"`
+	Crit  string   `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+func formatSensu(w io.Writer, name string, status *Status, annotations map[string]string) error {
+	result := &sensuResult{
+		Name:        name,
+		Status:      int(status.Value),
+		Output:      status.String(),
+		Annotations: annotations,
+	}
+	for _, p := range status.Perfdata {
+		result.Metrics = append(result.Metrics, sensuMetric{
+			Name:  p.Label,
+			Value: p.Value,
+			Unit:  p.UOM,
+			Warn:  p.Warn.String(),
+			Crit:  p.Crit.String(),
+			Min:   p.Min,
+			Max:   p.Max,
+		})
+	}
+	return json.NewEncoder(w).Encode(result)
+}
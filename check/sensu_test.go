@@ -0,0 +1,44 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+func TestFormatSensu(t *testing.T) {
+	status := NewStatus(nagios.NAGIOS_WARNING, "CheckLoad: 12.00")
+	status.AddPerfdata(NewPerfdata("load1", 12, "").Thresholds(MustParseRange("10"), MustParseRange("15")).Minimum(0))
+
+	var buf bytes.Buffer
+	output := &Output{Format: "sensu", Annotations: map[string]string{"team": "storage"}}
+	if err := output.Write(&buf, "load", status); err != nil {
+		t.Fatal(err)
+	}
+
+	var result sensuResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatal("output should be JSON:", err)
+	}
+	if result.Name != "load" || result.Status != 1 {
+		t.Errorf("expected load with status 1, result is %s with status %d.", result.Name, result.Status)
+	}
+	if result.Output != "WARNING: CheckLoad: 12.00 | load1=12;10;15;0" {
+		t.Errorf("unexpected output %q.", result.Output)
+	}
+	if len(result.Metrics) != 1 || result.Metrics[0].Warn != "10" || *result.Metrics[0].Min != 0 {
+		t.Errorf("unexpected metrics %+v.", result.Metrics)
+	}
+	if result.Annotations["team"] != "storage" {
+		t.Errorf("expected annotation team=storage, annotations are %v.", result.Annotations)
+	}
+}
+
+func TestOutputUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&Output{Format: "xml"}).Write(&buf, "load", Ok("")); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
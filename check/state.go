@@ -0,0 +1,189 @@
+package check
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// StateStore keeps the previous sample of a counter based check between
+// runs, in a file named after its key, so rates can be computed without
+// sleeping. A sample taken before the last reboot is discarded unless the
+// store is Persistent, as for readings such as disk usage which survive a
+// reboot.
+type StateStore struct {
+	Dir        string
+	Key        string
+	Procfs     *Procfs
+	Persistent bool
+}
+
+// StateFlags declares the --state-dir and --state-key flags. The default
+// key is usually the check name; checks configured differently must use
+// different keys. The directory can also be set with GO_CHECK_STATE_DIR.
+func StateFlags(flags FlagSet, procfs *Procfs, key string) *StateStore {
+	s := &StateStore{Procfs: procfs}
+	flags.Flag("state-dir", "Directory keeping samples between runs").Default(filepath.Join(os.TempDir(), "go_check")).OverrideDefaultFromEnvar("GO_CHECK_STATE_DIR").StringVar(&s.Dir)
+	flags.Flag("state-key", "Name the samples of this check are kept under").Default(key).StringVar(&s.Key)
+	return s
+}
+
+type savedState struct {
+	BootTime int64           `json:"btime"`
+	Time     time.Time       `json:"time"`
+	Value    json.RawMessage `json:"value"`
+}
+
+var unsafeKey = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func (s *StateStore) path() string {
+	return filepath.Join(s.Dir, unsafeKey.ReplaceAllString(s.Key, "_"))
+}
+
+// Load reads the saved sample into value. It returns the time the sample
+// was taken, and false if there is none or it predates a reboot.
+func (s *StateStore) Load(value interface{}) (time.Time, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer unlock()
+	return s.load(value)
+}
+
+// Save replaces the saved sample.
+func (s *StateStore) Save(value interface{}) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.save(value)
+}
+
+// Swap saves value and loads the sample it replaces into previous, holding
+// the lock in between so that concurrent runs each see a distinct previous
+// sample.
+func (s *StateStore) Swap(value, previous interface{}) (time.Time, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer unlock()
+	at, found, err := s.load(previous)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return at, found, s.save(value)
+}
+
+// Update loads the saved sample into value, calls update with whether one
+// was found, and saves value unless update fails, all under the lock.
+func (s *StateStore) Update(value interface{}, update func(found bool) error) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, found, err := s.load(value)
+	if err != nil {
+		return err
+	}
+	if err := update(found); err != nil {
+		return err
+	}
+	return s.save(value)
+}
+
+func (s *StateStore) load(value interface{}) (time.Time, bool, error) {
+	data, err := ioutil.ReadFile(s.path() + ".json")
+	if os.IsNotExist(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	state := &savedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		// a corrupt sample is as good as none, it is replaced on save
+		return time.Time{}, false, nil
+	}
+	if !s.Persistent {
+		btime, err := s.Procfs.BootTime()
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if state.BootTime != btime {
+			return time.Time{}, false, nil
+		}
+	}
+	if err := json.Unmarshal(state.Value, value); err != nil {
+		return time.Time{}, false, nil
+	}
+	return state.Time, true, nil
+}
+
+func (s *StateStore) save(value interface{}) error {
+	btime, err := s.Procfs.BootTime()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&savedState{BootTime: btime, Time: time.Now(), Value: raw})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.Dir, ".state")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path()+".json")
+}
+
+// lock takes an exclusive lock on the key and returns the function
+// releasing it.
+func (s *StateStore) lock() (func(), error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path()+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// CounterDelta returns how much a counter increased from before to after.
+// A counter that went down wrapped around max if max is set, and was reset
+// to zero otherwise.
+func CounterDelta(before, after, max uint64) uint64 {
+	if after >= before {
+		return after - before
+	}
+	if max > 0 && before <= max {
+		return max - before + after + 1
+	}
+	return after
+}
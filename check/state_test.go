@@ -0,0 +1,129 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newStateStore(t *testing.T) (*StateStore, func(btime string)) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := filepath.Join(dir, "proc")
+	os.Mkdir(proc, 0755)
+	boot := func(btime string) {
+		if err := ioutil.WriteFile(filepath.Join(proc, "stat"), []byte("cpu  1 2 3 4\nbtime "+btime+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	boot("1440587340")
+	return &StateStore{Dir: filepath.Join(dir, "state"), Key: "cpu/0", Procfs: &Procfs{ProcRoot: proc}}, boot
+}
+
+func TestStateSwap(t *testing.T) {
+	store, boot := newStateStore(t)
+	defer os.RemoveAll(filepath.Dir(store.Dir))
+
+	var previous map[string]int
+	if _, found, err := store.Swap(map[string]int{"ticks": 10}, &previous); err != nil || found {
+		t.Fatalf("the first run should have no previous sample, got %v, %v.", found, err)
+	}
+	at, found, err := store.Swap(map[string]int{"ticks": 20}, &previous)
+	if err != nil || !found || previous["ticks"] != 10 || at.IsZero() {
+		t.Errorf("expected the previous sample, got %v, %v, %v.", previous, found, err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "cpu_0.json")); err != nil {
+		t.Errorf("the key should be usable as a file name: %s", err)
+	}
+
+	boot("1440600000")
+	if _, found, _ := store.Load(&previous); found {
+		t.Error("a sample from before the reboot should be discarded.")
+	}
+}
+
+func TestStateCorrupt(t *testing.T) {
+	store, _ := newStateStore(t)
+	defer os.RemoveAll(filepath.Dir(store.Dir))
+
+	os.MkdirAll(store.Dir, 0755)
+	ioutil.WriteFile(filepath.Join(store.Dir, "cpu_0.json"), []byte("{"), 0644)
+	var previous int
+	if _, found, err := store.Swap(1, &previous); found || err != nil {
+		t.Errorf("a corrupt sample should be ignored, got %v, %v.", found, err)
+	}
+	if _, found, _ := store.Load(&previous); !found || previous != 1 {
+		t.Error("a corrupt sample should be replaced.")
+	}
+}
+
+func TestStateLocking(t *testing.T) {
+	store, _ := newStateStore(t)
+	defer os.RemoveAll(filepath.Dir(store.Dir))
+
+	// every run must see a distinct previous sample
+	seen := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var previous int
+			if _, found, err := store.Swap(i, &previous); err != nil {
+				t.Error(err)
+			} else if found {
+				seen <- previous
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(seen)
+	distinct := make(map[int]bool)
+	for previous := range seen {
+		if distinct[previous] {
+			t.Errorf("sample %d was seen twice.", previous)
+		}
+		distinct[previous] = true
+	}
+	if len(distinct) != 19 {
+		t.Errorf("expected 19 previous samples, got %d.", len(distinct))
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	for _, c := range []struct{ before, after, max, delta uint64 }{
+		{10, 25, 0, 15},
+		{4294967290, 5, 4294967295, 11},
+		{500, 20, 0, 20},
+	} {
+		if delta := CounterDelta(c.before, c.after, c.max); delta != c.delta {
+			t.Errorf("expected %d from %d to %d, delta is %d.", c.delta, c.before, c.after, delta)
+		}
+	}
+}
+
+func TestStateUpdate(t *testing.T) {
+	store, boot := newStateStore(t)
+	defer os.RemoveAll(filepath.Dir(store.Dir))
+	store.Persistent = true
+
+	var history []int
+	add := func(value int) func(bool) error {
+		return func(found bool) error {
+			history = append(history, value)
+			return nil
+		}
+	}
+	if err := store.Update(&history, add(1)); err != nil {
+		t.Fatal(err)
+	}
+	boot("1440600000")
+	history = nil
+	if err := store.Update(&history, add(2)); err != nil || len(history) != 2 || history[0] != 1 {
+		t.Errorf("a persistent store should keep samples across reboots, got %v, %v.", history, err)
+	}
+}
@@ -0,0 +1,60 @@
+package check
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+)
+
+// Maps the nagios.NagiosStatusVal entries to output strings
+var valMessages = []string{
+	"OK:",
+	"WARNING:",
+	"CRITICAL:",
+	"UNKNOWN:",
+}
+
+// Status is a nagios.NagiosStatus carrying performance data alongside the
+// check message.
+type Status struct {
+	nagios.NagiosStatus
+	Perfdata []*Perfdata
+}
+
+// State returns the name of the status value, such as OK or CRITICAL.
+func (s *Status) State() string {
+	return strings.TrimSuffix(valMessages[s.Value], ":")
+}
+
+// AddPerfdata appends metrics to the status.
+func (s *Status) AddPerfdata(perfdata ...*Perfdata) {
+	s.Perfdata = append(s.Perfdata, perfdata...)
+}
+
+// String renders the status in the Nagios plugin output format. The
+// perfdata section is appended to the first line of the message so that
+// multi-line messages remain valid long output.
+func (s *Status) String() string {
+	first, rest := s.Message, ""
+	if i := strings.Index(s.Message, "\n"); i >= 0 {
+		first, rest = s.Message[:i], s.Message[i:]
+	}
+	// a bare '|' in the message would be read as the perfdata separator
+	first = strings.Replace(first, "|", "/", -1)
+	rest = strings.Replace(rest, "|", "/", -1)
+
+	line := fmt.Sprintf("%s %s", valMessages[s.Value], first)
+	if len(s.Perfdata) > 0 {
+		line += " | " + FormatPerfdata(s.Perfdata)
+	}
+	return line + rest
+}
+
+// ExitWithStatus prints the status with its perfdata and exits with the
+// status value.
+func ExitWithStatus(status *Status) {
+	fmt.Fprintln(os.Stdout, status.String())
+	os.Exit(int(status.Value))
+}
@@ -0,0 +1,116 @@
+// Package config loads named check instances from a YAML or JSON file:
+//
+//	interval: 1m
+//	checks:
+//	  - name: rootfs
+//	    command: disk
+//	    args: ["--include=^/$"]
+//	    warn: "85"
+//	    crit: "95"
+//	  - name: api
+//	    command: http
+//	    args: ["--url=http://localhost:8080/health"]
+//	    interval: 10s
+//
+// Warn and crit are passed to the check as --warn-level and --crit-level.
+// JSON files use the same keys.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/yaml.v2"
+	"github.com/AcalephStorage/go_check/agent"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// DefaultInterval is used when neither the file nor the instance sets an
+// interval.
+const DefaultInterval = time.Minute
+
+// Config is a set of named check instances.
+type Config struct {
+	Interval time.Duration `yaml:"interval"`
+	Checks   []*Instance   `yaml:"checks"`
+}
+
+// Instance is one invocation of a check subcommand.
+type Instance struct {
+	Name     string        `yaml:"name"`
+	Command  string        `yaml:"command"`
+	Args     []string      `yaml:"args"`
+	Warn     string        `yaml:"warn"`
+	Crit     string        `yaml:"crit"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Load reads a config file.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return config, nil
+}
+
+// Parse parses a YAML or JSON config. Unknown keys are rejected so that a
+// misspelt threshold does not go unnoticed.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i, instance := range config.Checks {
+		if instance == nil || instance.Name == "" {
+			return nil, fmt.Errorf("check %d has no name", i+1)
+		}
+		if instance.Command == "" {
+			return nil, fmt.Errorf("check %s has no command", instance.Name)
+		}
+		if seen[instance.Name] {
+			return nil, fmt.Errorf("duplicate check '%s'", instance.Name)
+		}
+		seen[instance.Name] = true
+	}
+	return config, nil
+}
+
+// Arguments returns the command line arguments of the instance, including
+// its thresholds.
+func (i *Instance) Arguments() []string {
+	args := append([]string{}, i.Args...)
+	if i.Warn != "" {
+		args = append(args, "--warn-level="+i.Warn)
+	}
+	if i.Crit != "" {
+		args = append(args, "--crit-level="+i.Crit)
+	}
+	return args
+}
+
+// Jobs creates an agent job for every instance.
+func (c *Config) Jobs(definitions []*check.Definition) ([]*agent.Job, error) {
+	jobs := make([]*agent.Job, len(c.Checks))
+	for n, instance := range c.Checks {
+		interval := instance.Interval
+		if interval == 0 {
+			interval = c.Interval
+		}
+		if interval == 0 {
+			interval = DefaultInterval
+		}
+		job, err := agent.NewJob(definitions, instance.Name, interval, instance.Command, instance.Arguments())
+		if err != nil {
+			return nil, err
+		}
+		jobs[n] = job
+	}
+	return jobs, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AcalephStorage/go_check/check"
+)
+
+var definitions = []*check.Definition{
+	{
+		Name: "level",
+		Register: func(flags check.FlagSet) check.Check {
+			flags.Flag("warn-level", "warn range").String()
+			flags.Flag("crit-level", "crit range").String()
+			flags.Flag("path", "path").String()
+			return check.CheckFunc(func() *check.Status { return check.Ok("fine") })
+		},
+	},
+}
+
+func TestParseYAML(t *testing.T) {
+	config, err := Parse([]byte(`
+interval: 30s
+checks:
+  - name: rootfs
+    command: level
+    args: ["--path=/"]
+    warn: "85"
+    crit: "95"
+  - name: boot
+    command: level
+    interval: 5m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := config.Jobs(definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d.", len(jobs))
+	}
+	args := jobs[0].Args
+	if len(args) != 3 || args[0] != "--path=/" || args[1] != "--warn-level=85" || args[2] != "--crit-level=95" {
+		t.Errorf("unexpected rootfs arguments %v.", args)
+	}
+	if jobs[0].Interval != 30*time.Second || jobs[1].Interval != 5*time.Minute {
+		t.Errorf("expected intervals 30s and 5m, got %v and %v.", jobs[0].Interval, jobs[1].Interval)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	config, err := Parse([]byte(`{"checks": [{"name": "rootfs", "command": "level", "crit": "95"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := config.Jobs(definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs[0].Interval != DefaultInterval {
+		t.Errorf("expected the default interval, got %v.", jobs[0].Interval)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		"checks: [{command: level}]",
+		"checks: [{name: a}]",
+		"checks: [{name: a, command: level}, {name: a, command: level}]",
+		"checks: [{name: a, command: level, critical: 95}]",
+		"checks: [{name: a, command: level, interval: soon}]",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("config %q should be invalid.", data)
+		}
+	}
+
+	config, _ := Parse([]byte("checks: [{name: a, command: nope}]"))
+	if _, err := config.Jobs(definitions); err == nil {
+		t.Error("unknown command should be rejected.")
+	}
+}
@@ -1,50 +1,342 @@
-package main
+package cpu
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"math"
 	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-var (
-	warnLevel = kingpin.Flag("warn-level", "warn level").Default("80").Float()
-	critLevel = kingpin.Flag("crit-level", "critical level").Default("90").Float()
-)
+var cpuStates = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+
+// Definition is the cpu subcommand.
+var Definition = &check.Definition{
+	Name:     "cpu",
+	Help:     "Check total, per-state and per-core CPU usage.",
+	Register: register,
+}
+
+type cpuCheck struct {
+	warnLevel     *check.Range
+	critLevel     *check.Range
+	stateWarn     map[string]string
+	stateCrit     map[string]string
+	coreWarnLevel *check.Range
+	coreCritLevel *check.Range
+	coreCount     int
+	interval      time.Duration
+	samples       int
+	aggregate     string
+	stateful      bool
+	state         *check.StateStore
+	procfs        *check.Procfs
+}
+
+func register(flags check.FlagSet) check.Check {
+	c := &cpuCheck{
+		warnLevel:     check.RangeFlag(flags.Flag("warn-level", "warn range for total cpu usage").Default("80")),
+		critLevel:     check.RangeFlag(flags.Flag("crit-level", "critical range for total cpu usage").Default("90")),
+		stateWarn:     make(map[string]string),
+		stateCrit:     make(map[string]string),
+		coreWarnLevel: check.RangeFlag(flags.Flag("core-warn-level", "warn range for the usage of a single core")),
+		coreCritLevel: check.RangeFlag(flags.Flag("core-crit-level", "critical range for the usage of a single core")),
+		procfs:        check.ProcfsFlags(flags),
+	}
+	c.state = check.StateFlags(flags, c.procfs, "cpu")
+	flags.Flag("state-warn-level", "STATE=RANGE warn range for the usage of a cpu state such as iowait or steal").StringMapVar(&c.stateWarn)
+	flags.Flag("state-crit-level", "STATE=RANGE critical range for the usage of a cpu state such as iowait or steal").StringMapVar(&c.stateCrit)
+	flags.Flag("core-count", "Number of cores that must be outside their level to alert").Default("1").IntVar(&c.coreCount)
+	flags.Flag("interval", "Time between two samples of /proc/stat").Default("1s").DurationVar(&c.interval)
+	flags.Flag("samples", "Number of intervals to sample").Default("1").IntVar(&c.samples)
+	flags.Flag("aggregate", "How to combine the samples: avg, max or a percentile such as p95").Default("avg").StringVar(&c.aggregate)
+	flags.Flag("stateful", "Compare against the counters saved by the previous run, if at least an interval ago, instead of sampling").BoolVar(&c.stateful)
+	return c
+}
+
+func (c *cpuCheck) Run() *check.Status {
+	aggregate, err := parseAggregate(c.aggregate)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	if c.samples < 1 {
+		return check.Unknownf("samples must be at least 1")
+	}
+
+	var usages []*usage
+	if c.stateful {
+		u, err := c.sinceLastRun()
+		if err != nil {
+			return check.Unknown(err)
+		}
+		if u != nil {
+			usages = append(usages, u)
+		}
+	}
+	if usages == nil {
+		// no previous run to compare with, sample now
+		if usages, err = c.sample(); err != nil {
+			return check.Unknown(err)
+		}
+	}
+	return c.evaluate(combine(usages, aggregate))
+}
+
+// sample reads /proc/stat every interval and returns the usage over each
+// of them.
+func (c *cpuCheck) sample() ([]*usage, error) {
+	before, err := readCpuStat(c.procfs)
+	if err != nil {
+		return nil, err
+	}
+	usages := make([]*usage, c.samples)
+	for i := range usages {
+		time.Sleep(c.interval)
+		after, err := readCpuStat(c.procfs)
+		if err != nil {
+			return nil, err
+		}
+		usages[i] = measure(before, after)
+		before = after
+	}
+	if c.stateful {
+		if err := c.state.Save(toSaved(before)); err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkCpu(*warnLevel, *critLevel)
+// sinceLastRun returns the usage since the counters saved by the previous
+// run, and saves the current ones. It returns nil on the first run after a
+// boot, or if the previous run is less than an interval ago and too few
+// jiffies have passed to be meaningful.
+func (c *cpuCheck) sinceLastRun() (*usage, error) {
+	after, err := readCpuStat(c.procfs)
+	if err != nil {
+		return nil, err
+	}
+	saved := make(savedStat)
+	at, found, err := c.state.Swap(toSaved(after), &saved)
+	if err != nil {
+		return nil, err
+	}
+	before := saved.stats()
+	if !found || before == nil || time.Since(at) < c.interval {
+		return nil, nil
+	}
+	return measure(before, after), nil
+}
+
+// usage is the cpu usage over an interval, in percent.
+type usage struct {
+	total float64
+	each  []float64
+	cores []*coreUsage
+}
+
+type coreUsage struct {
+	name  string
+	total float64
 }
 
-func checkCpu(warnLevel, critLevel float64) {
-	before := readCpuStat()
-	if before == nil {
-		nagios.Unknown("Unable to check CPU status")
+// measure computes the usage between two samples of /proc/stat. Cores that
+// came online between the samples are left out.
+func measure(before, after []*cpuStat) *usage {
+	u := &usage{}
+	u.total, _, u.each = compute(before[0].counters, after[0].counters)
+	previous := make(map[string][]int64)
+	for _, stat := range before[1:] {
+		previous[stat.name] = stat.counters
 	}
-	time.Sleep(1 * time.Second)
-	after := readCpuStat()
-	total, _, each := compute(before, after)
+	for _, stat := range after[1:] {
+		if counters, ok := previous[stat.name]; ok {
+			total, _, _ := compute(counters, stat.counters)
+			u.cores = append(u.cores, &coreUsage{name: stat.name, total: total})
+		}
+	}
+	return u
+}
 
-	status := &nagios.NagiosStatus{}
+// combine aggregates every figure of the usages over the samples. The cores
+// are those of the last sample.
+func combine(usages []*usage, aggregate func([]float64) float64) *usage {
+	last := usages[len(usages)-1]
+	if len(usages) == 1 {
+		return last
+	}
+	values := func(get func(u *usage) (float64, bool)) float64 {
+		var v []float64
+		for _, u := range usages {
+			if value, ok := get(u); ok {
+				v = append(v, value)
+			}
+		}
+		return aggregate(v)
+	}
+
+	combined := &usage{each: make([]float64, len(last.each))}
+	combined.total = values(func(u *usage) (float64, bool) { return u.total, true })
+	for i := range combined.each {
+		combined.each[i] = values(func(u *usage) (float64, bool) {
+			if i < len(u.each) {
+				return u.each[i], true
+			}
+			return 0, false
+		})
+	}
+	for _, core := range last.cores {
+		name := core.name
+		combined.cores = append(combined.cores, &coreUsage{name: name, total: values(func(u *usage) (float64, bool) {
+			for _, c := range u.cores {
+				if c.name == name {
+					return c.total, true
+				}
+			}
+			return 0, false
+		})})
+	}
+	return combined
+}
+
+// parseAggregate returns the function combining samples: avg, max or pN
+// for the Nth percentile.
+func parseAggregate(spec string) (func([]float64) float64, error) {
+	switch spec {
+	case "avg":
+		return average, nil
+	case "max":
+		return maximum, nil
+	}
+	if strings.HasPrefix(spec, "p") {
+		if p, err := strconv.ParseFloat(spec[1:], 64); err == nil && p > 0 && p <= 100 {
+			return func(values []float64) float64 { return percentile(values, p) }, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown aggregate '%s', expected avg, max or a percentile such as p95", spec)
+}
+
+func average(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func maximum(values []float64) float64 {
+	max := values[0]
+	for _, v := range values[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// percentile returns the nearest-rank percentile of the values.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// evaluate checks the cpu usage against the levels.
+func (c *cpuCheck) evaluate(u *usage) *check.Status {
+	stateWarn, err := stateRanges(c.stateWarn)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	stateCrit, err := stateRanges(c.stateCrit)
+	if err != nil {
+		return check.Unknown(err)
+	}
+
+	total, each := u.total, u.each
+
+	status := &check.Status{}
+	status.Value = check.Evaluate(total, c.warnLevel, c.critLevel)
+	for i, value := range each {
+		if i < len(cpuStates) {
+			if state := check.Evaluate(value, stateWarn[cpuStates[i]], stateCrit[cpuStates[i]]); state > status.Value {
+				status.Value = state
+			}
+		}
+	}
+
+	var cores bytes.Buffer
+	var coreMetrics []*check.Perfdata
+	warnCores, critCores := 0, 0
+	for _, core := range u.cores {
+		switch check.Evaluate(core.total, c.coreWarnLevel, c.coreCritLevel) {
+		case nagios.NAGIOS_CRITICAL:
+			critCores++
+			fmt.Fprintf(&cores, " %s=%0.2f", core.name, core.total)
+		case nagios.NAGIOS_WARNING:
+			warnCores++
+			fmt.Fprintf(&cores, " %s=%0.2f", core.name, core.total)
+		}
+		coreMetrics = append(coreMetrics, check.NewPerfdata(core.name, core.total, "%").Thresholds(c.coreWarnLevel, c.coreCritLevel).Bounds(0, 100).Metric("core_usage", map[string]string{"cpu": core.name}))
+	}
+	coreState := nagios.NAGIOS_OK
 	switch {
-	case total >= critLevel:
-		status.Value = nagios.NAGIOS_CRITICAL
-	case total >= warnLevel:
-		status.Value = nagios.NAGIOS_WARNING
-	default:
-		status.Value = nagios.NAGIOS_OK
+	case critCores >= c.coreCount && critCores > 0:
+		coreState = nagios.NAGIOS_CRITICAL
+	case critCores+warnCores >= c.coreCount && critCores+warnCores > 0:
+		coreState = nagios.NAGIOS_WARNING
+	}
+	if coreState > status.Value {
+		status.Value = coreState
 	}
 
 	status.Message = fmt.Sprintf("total=%0.2f user=%0.2f nice=%0.2f system=%0.2f idle=%0.2f iowait=%0.2f irq=%0.2f softirq=%0.2f steal=%0.2f guest=%0.2f guest_nice=%0.2f", total, each[0], each[1], each[2], each[3], each[4], each[5], each[6], each[7], each[8], each[9])
-	nagios.ExitWithStatus(status)
+	if cores.Len() > 0 {
+		status.Message += fmt.Sprintf("\n%d of %d cores over their level:%s", critCores+warnCores, len(coreMetrics), cores.String())
+	}
+	status.AddPerfdata(check.NewPerfdata("total", total, "%").Thresholds(c.warnLevel, c.critLevel).Bounds(0, 100))
+	for i, value := range each {
+		if i < len(cpuStates) {
+			status.AddPerfdata(check.NewPerfdata(cpuStates[i], value, "%").Thresholds(stateWarn[cpuStates[i]], stateCrit[cpuStates[i]]).Bounds(0, 100).Metric("usage", map[string]string{"state": cpuStates[i]}))
+		}
+	}
+	status.AddPerfdata(coreMetrics...)
+	return status
+}
+
+// stateRanges parses STATE=RANGE levels, rejecting unknown states.
+func stateRanges(levels map[string]string) (map[string]*check.Range, error) {
+	ranges := make(map[string]*check.Range)
+	for state, spec := range levels {
+		if !isState(state) {
+			return nil, fmt.Errorf("unknown cpu state '%s', expected one of %s", state, strings.Join(cpuStates, ", "))
+		}
+		r, err := check.ParseRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		ranges[state] = r
+	}
+	return ranges, nil
+}
+
+func isState(name string) bool {
+	for _, state := range cpuStates {
+		if state == name {
+			return true
+		}
+	}
+	return false
 }
 
 func compute(before []int64, after []int64) (total, free float64, each []float64) {
@@ -57,6 +349,10 @@ func compute(before []int64, after []int64) (total, free float64, each []float64
 		totalDiff += diff[i]
 	}
 	each = make([]float64, len(after))
+	if totalDiff == 0 {
+		// no time passed on this cpu, report it as idle
+		return 0, 100, each
+	}
 	for i, d := range diff {
 		each[i] = 100 * (float64(d) / float64(totalDiff))
 	}
@@ -66,20 +362,87 @@ func compute(before []int64, after []int64) (total, free float64, each []float64
 	return total, free, each
 }
 
+// cpuStat is a line of /proc/stat: the jiffies a cpu spent in each of
 // [user, nice, system, idle, iowait, irq, softirq, steal, guest, guest_nice]
+type cpuStat struct {
+	name     string
+	counters []int64
+}
 
-func readCpuStat() []int64 {
-	file, _ := os.Open("/proc/stat")
+// readCpuStat returns the aggregate cpu line followed by the cpuN lines,
+// sorted by core number.
+func readCpuStat(procfs *check.Procfs) ([]*cpuStat, error) {
+	file, err := os.Open(procfs.Proc("stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var total *cpuStat
+	var cores []*cpuStat
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := scanner.Text()
-		stat, _ := regexp.MatchString("^cpu ", line)
-		if stat {
-			arr := strings.Fields(line)
-			return toIntArray(arr[1:])
+		arr := strings.Fields(scanner.Text())
+		if len(arr) < 5 || !strings.HasPrefix(arr[0], "cpu") {
+			continue
+		}
+		counters := toIntArray(arr[1:])
+		for len(counters) < len(cpuStates) {
+			// older kernels have fewer columns
+			counters = append(counters, 0)
+		}
+		stat := &cpuStat{name: arr[0], counters: counters}
+		if arr[0] == "cpu" {
+			total = stat
+		} else {
+			cores = append(cores, stat)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if total == nil {
+		return nil, fmt.Errorf("no cpu line in %s", procfs.Proc("stat"))
+	}
+	sort.Sort(byCore(cores))
+	return append([]*cpuStat{total}, cores...), nil
+}
+
+// savedStat is the form /proc/stat samples are kept in between runs.
+type savedStat map[string][]int64
+
+func toSaved(stats []*cpuStat) savedStat {
+	saved := make(savedStat)
+	for _, stat := range stats {
+		saved[stat.name] = stat.counters
+	}
+	return saved
+}
+
+// stats returns the saved sample in readCpuStat order, or nil if it has no
+// aggregate cpu line.
+func (saved savedStat) stats() []*cpuStat {
+	counters, ok := saved["cpu"]
+	if !ok {
+		return nil
+	}
+	var cores []*cpuStat
+	for name, counters := range saved {
+		if name != "cpu" {
+			cores = append(cores, &cpuStat{name: name, counters: counters})
 		}
 	}
-	return nil
+	sort.Sort(byCore(cores))
+	return append([]*cpuStat{{name: "cpu", counters: counters}}, cores...)
+}
+
+type byCore []*cpuStat
+
+func (c byCore) Len() int      { return len(c) }
+func (c byCore) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCore) Less(i, j int) bool {
+	a, _ := strconv.Atoi(strings.TrimPrefix(c[i].name, "cpu"))
+	b, _ := strconv.Atoi(strings.TrimPrefix(c[j].name, "cpu"))
+	return a < b
 }
 
 func toIntArray(arr []string) []int64 {
@@ -0,0 +1,186 @@
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+var fixture = &check.Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/sys"}
+
+// samples returns the fixture /proc/stat before and after a second of
+// usage: cpu0 is pegged, cpu1 is at 10%, cpu2 waits on IO half of the
+// time and cpu3 is idle.
+func samples(t *testing.T) ([]*cpuStat, []*cpuStat) {
+	before, err := readCpuStat(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := readCpuStat(&check.Procfs{ProcRoot: "testdata/after/proc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return before, after
+}
+
+func newCheck() *cpuCheck {
+	return &cpuCheck{
+		warnLevel: check.MustParseRange("80"),
+		critLevel: check.MustParseRange("90"),
+		stateWarn: map[string]string{},
+		stateCrit: map[string]string{},
+		coreCount: 1,
+		samples:   1,
+		aggregate: "avg",
+		procfs:    fixture,
+	}
+}
+
+func TestReadCpuStat(t *testing.T) {
+	stat, err := readCpuStat(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stat) != 5 || stat[0].name != "cpu" || stat[4].name != "cpu3" {
+		t.Fatalf("expected the cpu line and 4 cores, got %d lines.", len(stat))
+	}
+	if len(stat[0].counters) != 10 || stat[0].counters[0] != 1000 || stat[0].counters[3] != 8000 {
+		t.Errorf("unexpected cpu counters %v.", stat[0].counters)
+	}
+
+	if _, err := readCpuStat(&check.Procfs{ProcRoot: "testdata/missing"}); err == nil {
+		t.Error("a missing proc root should be an error.")
+	}
+}
+
+func TestCompute(t *testing.T) {
+	before := []int64{100, 0, 100, 700, 100, 0, 0, 0, 0, 0}
+	after := []int64{200, 0, 200, 1300, 300, 0, 0, 0, 0, 0}
+	total, free, each := compute(before, after)
+	if total != 40 || free != 60 || each[4] != 20 {
+		t.Errorf("expected total 40, free 60 and iowait 20, got %v, %v and %v.", total, free, each[4])
+	}
+
+	if total, _, _ := compute(before, before); total != 0 {
+		t.Errorf("a cpu without ticks should be idle, usage is %v.", total)
+	}
+}
+
+func TestEvaluateTotal(t *testing.T) {
+	status := newCheck().evaluate(measure(samples(t)))
+	if status.Value != nagios.NAGIOS_OK {
+		t.Errorf("expected OK, status is %v.", status)
+	}
+	if status.Perfdata[0].Value != 40 || status.Perfdata[5].Value != 12.5 {
+		t.Errorf("expected 40%% total and 12.5%% iowait, got %v and %v.", status.Perfdata[0].Value, status.Perfdata[5].Value)
+	}
+	cores := status.Perfdata[len(cpuStates)+1:]
+	if len(cores) != 4 || cores[0].Value != 100 || cores[1].Value != 10 || cores[2].Labels["cpu"] != "cpu2" {
+		t.Errorf("unexpected per core perfdata %v.", check.FormatPerfdata(cores))
+	}
+}
+
+func TestEvaluateStates(t *testing.T) {
+	c := newCheck()
+	c.stateWarn["iowait"] = "10"
+	c.stateCrit["steal"] = "5"
+	status := c.evaluate(measure(samples(t)))
+	if status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("12.5%% iowait should be WARNING, status is %v.", status)
+	}
+
+	c.stateCrit["stolen"] = "5"
+	if status := c.evaluate(measure(samples(t))); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("unknown state should be UNKNOWN, status is %v.", status)
+	}
+}
+
+func TestEvaluateCores(t *testing.T) {
+	c := newCheck()
+	c.coreWarnLevel = check.MustParseRange("40")
+	c.coreCritLevel = check.MustParseRange("90")
+	status := c.evaluate(measure(samples(t)))
+	if status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("a pegged core should be CRITICAL, status is %v.", status)
+	}
+	expected := "2 of 4 cores over their level: cpu0=100.00 cpu2=50.00"
+	if !strings.HasSuffix(status.Message, expected) {
+		t.Errorf("expected %q at the end of %q.", expected, status.Message)
+	}
+
+	c.coreCount = 2
+	if status := c.evaluate(measure(samples(t))); status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("one critical and one warning core should be WARNING, status is %v.", status)
+	}
+	c.coreCount = 3
+	if status := c.evaluate(measure(samples(t))); status.Value != nagios.NAGIOS_OK {
+		t.Errorf("two cores over their level should be OK, status is %v.", status)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{10, 50, 20, 90, 30}
+	for spec, expected := range map[string]float64{"avg": 40, "max": 90, "p50": 30, "p80": 50, "p100": 90} {
+		aggregate, err := parseAggregate(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := aggregate(values); v != expected {
+			t.Errorf("expected %s to be %v, got %v.", spec, expected, v)
+		}
+	}
+	for _, spec := range []string{"", "median", "p0", "p101", "pxx"} {
+		if _, err := parseAggregate(spec); err == nil {
+			t.Errorf("aggregate %q should be invalid.", spec)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	busy := &usage{total: 90, each: []float64{90, 0, 0, 10}, cores: []*coreUsage{{"cpu0", 100}, {"cpu1", 80}}}
+	quiet := &usage{total: 10, each: []float64{10, 0, 0, 90}, cores: []*coreUsage{{"cpu0", 20}}}
+	combined := combine([]*usage{busy, quiet, busy}, maximum)
+	if combined.total != 90 || combined.each[3] != 90 {
+		t.Errorf("expected max total 90 and idle 90, got %v and %v.", combined.total, combined.each[3])
+	}
+	if len(combined.cores) != 2 || combined.cores[1].name != "cpu1" || combined.cores[1].total != 80 {
+		t.Errorf("expected the cores of the last sample, got %+v.", combined.cores)
+	}
+	if combine([]*usage{quiet}, maximum) != quiet {
+		t.Error("a single sample should be used as is.")
+	}
+}
+
+func TestStateful(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCheck()
+	c.interval = 0
+	c.stateful = true
+	c.state = &check.StateStore{Dir: dir, Key: "cpu", Procfs: fixture}
+	c.coreCritLevel = check.MustParseRange("90")
+
+	// the first run samples, and saves the fixture counters
+	if status := c.Run(); status.Value != nagios.NAGIOS_OK {
+		t.Errorf("an idle sample should be OK, status is %v.", status)
+	}
+	saved := make(savedStat)
+	if _, found, err := c.state.Load(&saved); err != nil || !found || saved["cpu"][0] != 1000 {
+		t.Fatalf("expected the saved counters, got %v, %v.", saved, err)
+	}
+
+	// the next one compares against them right away
+	c.procfs = &check.Procfs{ProcRoot: "testdata/after/proc"}
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_CRITICAL || status.Perfdata[0].Value != 40 {
+		t.Errorf("expected the usage since the last run, status is %v.", status)
+	}
+}
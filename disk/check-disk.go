@@ -1,15 +1,17 @@
-package main
+package disk
 
 import (
 	"bytes"
 	"fmt"
-	"strconv"
+	"path"
+	"regexp"
 	"strings"
+	"text/tabwriter"
+	"time"
 
-	"os/exec"
-
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/alecthomas/units"
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
 const (
@@ -42,68 +44,410 @@ type diskResult struct {
 	capacity   int
 	mounted    string
 	usage      useType
+	// hasInodes is false for filesystems without a fixed inode count, such
+	// as btrfs, which df reports as '-'
+	hasInodes     bool
+	inodes        int64
+	inodesUsed    int64
+	inodesFree    int64
+	inodeCapacity int
+	// rule is the level rule matching the device, nil for the default
+	// levels
+	rule *levelRule
+	// scale is the magic number factor of the free space percentage, 0
+	// when the levels are not scaled
+	scale float64
+	// growth is the trend of the used KB per second over the usage
+	// history, set when hasTrend
+	hasTrend bool
+	growth   float64
 }
 
-var (
-	warnLevel = kingpin.Flag("warn-level", "warn level").Default("85").Int()
-	critLevel = kingpin.Flag("crit-level", "crit level").Default("95").Int()
-)
+// defaultExcludeType leaves out memory backed filesystems and autofs, whose
+// mount points would be automounted, or hang, on statfs.
+const defaultExcludeType = "^(tmpfs|devtmpfs|autofs)$"
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkDisk(*warnLevel, *critLevel)
+// Definition is the disk subcommand.
+var Definition = &check.Definition{
+	Name:     "disk",
+	Help:     "Check disk capacity of mounted filesystems.",
+	Register: register,
 }
 
-func checkDisk(warnLevel, critLevel int) {
-	result := getData()
-	devices, outputText := parseResult(result)
-	critCount, warnCount, problems := summarize(devices, critLevel, warnLevel)
-	status := doCheck(critCount, warnCount, outputText, problems)
-	nagios.ExitWithStatus(status)
+type diskCheck struct {
+	warnLevel      *check.Range
+	critLevel      *check.Range
+	inodeWarnLevel *check.Range
+	inodeCritLevel *check.Range
+	mountRules     []string
+	typeRules      []string
+	warnFree       units.Base2Bytes
+	critFree       units.Base2Bytes
+	magic          float64
+	magicBase      units.Base2Bytes
+	filter         mountFilter
+	fillWarnTime   time.Duration
+	fillCritTime   time.Duration
+	trendWindow    time.Duration
+	state          *check.StateStore
+	now            func() time.Time
+	expectRW       *regexp.Regexp
+	writeProbes    []string
+	fstab          string
+	expectMounts   []string
+	timeout        time.Duration
+	skipStale      bool
+	procfs         *check.Procfs
+	statfs         statfsFunc
 }
 
-func getData() string {
-	cmd := exec.Command("df", "-PT", "-x", "tmpfs", "-x", "devtmpfs")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+func register(flags check.FlagSet) check.Check {
+	c := &diskCheck{
+		warnLevel:      check.RangeFlag(flags.Flag("warn-level", "warn range for capacity percentage").Default("85")),
+		critLevel:      check.RangeFlag(flags.Flag("crit-level", "crit range for capacity percentage").Default("95")),
+		inodeWarnLevel: check.RangeFlag(flags.Flag("inode-warn-level", "warn range for inode usage percentage").Default("85")),
+		inodeCritLevel: check.RangeFlag(flags.Flag("inode-crit-level", "crit range for inode usage percentage").Default("95")),
+		procfs:         check.ProcfsFlags(flags),
+		statfs:         statfs,
+		now:            time.Now,
+	}
+	c.state = check.StateFlags(flags, c.procfs, "disk")
+	c.state.Persistent = true
+	flags.Flag("mount-level", "PATTERN=WARN,CRIT capacity ranges for mount points matching the regex, the first match wins").StringsVar(&c.mountRules)
+	flags.Flag("type-level", "TYPE=WARN,CRIT capacity ranges for SYSTEM, OSD or RBD devices, used when no mount level matches").StringsVar(&c.typeRules)
+	flags.Flag("warn-free", "Warn when a filesystem has less free space than this, such as 10GiB").BytesVar(&c.warnFree)
+	flags.Flag("crit-free", "Crit when a filesystem has less free space than this, such as 5GiB").BytesVar(&c.critFree)
+	flags.Flag("magic", "Scale capacity levels by filesystem size like check_mk's df magic number, between 0 and 1, 0 to disable").Default("0").FloatVar(&c.magic)
+	flags.Flag("magic-base", "Filesystem size the capacity levels apply to unscaled with --magic").Default("20GiB").BytesVar(&c.magicBase)
+	flags.Flag("fill-warn-time", "Warn when a filesystem is projected to fill up sooner than this, such as 24h").DurationVar(&c.fillWarnTime)
+	flags.Flag("fill-crit-time", "Crit when a filesystem is projected to fill up sooner than this, such as 4h").DurationVar(&c.fillCritTime)
+	flags.Flag("trend-window", "Usage history the time to full is projected from").Default("24h").DurationVar(&c.trendWindow)
+	flags.Flag("include-mount", "Only check mount points matching this regex").StringVar(&c.filter.includeMount)
+	flags.Flag("exclude-mount", "Skip mount points matching this regex").StringVar(&c.filter.excludeMount)
+	flags.Flag("include-type", "Only check filesystem types matching this regex").StringVar(&c.filter.includeType)
+	flags.Flag("exclude-type", "Skip filesystem types matching this regex").Default(defaultExcludeType).StringVar(&c.filter.excludeType)
+	flags.Flag("include-device", "Only check devices matching this regex").StringVar(&c.filter.includeDevice)
+	flags.Flag("exclude-device", "Skip devices matching this regex").StringVar(&c.filter.excludeDevice)
+	flags.Flag("expect-rw", "Go critical when a mount point matching this regex is read-only; filesystems remounted read-only on errors always do").SetValue(regexpValue{&c.expectRW})
+	flags.Flag("write-probe", "Directory to create, sync and remove a file in to detect hung or read-only filesystems, repeatable").StringsVar(&c.writeProbes)
+	flags.Flag("fstab", "Go critical when a filesystem of this fstab, such as /etc/fstab, is not mounted").StringVar(&c.fstab)
+	flags.Flag("expect-mount", "Mount point that must be mounted, repeatable").StringsVar(&c.expectMounts)
+	flags.Flag("timeout", "Time to wait for each mount to answer statfs and for each write probe").Default("5s").DurationVar(&c.timeout)
+	flags.Flag("skip-stale", "Skip network mounts that do not answer instead of going critical").BoolVar(&c.skipStale)
+	return c
+}
+
+func (c *diskCheck) Run() *check.Status {
+	mounts, err := readMounts(c.procfs)
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
 	}
-	return out.String()
+	filter, err := c.filter.compile()
+	if err != nil {
+		return check.Unknown(err)
+	}
+	rules, err := c.rules()
+	if err != nil {
+		return check.Unknown(err)
+	}
+	if c.magic < 0 || c.magic > 1 {
+		return check.Unknownf("--magic must be between 0 and 1, got %v", c.magic)
+	}
+	freeWarn, err := freeLevel(c.warnFree)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	freeCrit, err := freeLevel(c.critFree)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	fillWarn, err := durationLevel(c.fillWarnTime)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	fillCrit, err := durationLevel(c.fillCritTime)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	devices, unresponsive, skipped := c.collect(mounts, filter)
+	if fillWarn.IsSet() || fillCrit.IsSet() {
+		if err := c.trend(devices); err != nil {
+			return check.Unknown(err)
+		}
+	}
+	applyRules(devices, rules)
+	if c.magic > 0 {
+		for _, device := range devices {
+			device.scale = magicScale(device.blocks, c.magic, c.magicBase)
+		}
+	}
+	critCount, warnCount, problems := summarize(devices, c.critLevel, c.warnLevel, c.inodeCritLevel, c.inodeWarnLevel)
+	freeCritCount, freeWarnCount, freeProblems := summarizeFree(devices, freeCrit, freeWarn)
+	critCount += freeCritCount
+	warnCount += freeWarnCount
+	problems += freeProblems
+	fillCritCount, fillWarnCount, fillProblems := summarizeFill(devices, fillCrit, fillWarn)
+	critCount += fillCritCount
+	warnCount += fillWarnCount
+	problems += fillProblems
+	readOnly := c.readOnly(mounts, filter)
+	missing, err := c.missing(mounts, filter)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	unresponsive = append(unresponsive, missing...)
+	unresponsive = append(unresponsive, readOnly...)
+	unresponsive = append(unresponsive, c.probe()...)
+	critCount += len(unresponsive)
+	problems = strings.Join(unresponsive, "") + problems
+	outputText := formatDevices(devices) + formatFill(devices)
+	if len(skipped) > 0 {
+		outputText += fmt.Sprintf("   Skipped stale mounts: %s\n", strings.Join(skipped, ", "))
+	}
+	status := doCheck(critCount, warnCount, outputText, problems)
+	status.AddPerfdata(perfdata(devices, c.critLevel, c.warnLevel, c.inodeCritLevel, c.inodeWarnLevel, freeCrit, freeWarn)...)
+	status.AddPerfdata(trendPerfdata(devices, fillCrit, fillWarn)...)
+	return status
 }
 
-func parseResult(result string) ([]*diskResult, string) {
-	var buf bytes.Buffer
-	lines := strings.Split(result, "\n")
-	devices := make([]*diskResult, len(lines)-1)
-	for i, line := range lines {
-		if i == 0 {
-			fmt.Fprintln(&buf, "  ", line)
+// rules returns the mount rules followed by the type rules.
+func (c *diskCheck) rules() ([]*levelRule, error) {
+	var rules []*levelRule
+	for _, spec := range c.mountRules {
+		rule, err := parseMountRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range c.typeRules {
+		rule, err := parseTypeRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// collect runs statfs on every mount selected by the filter. Mounts that
+// fail are returned as problem lines, or as skipped if they are stale
+// network mounts and those are skipped. Like df, filesystems without blocks
+// such as proc are left out.
+func (c *diskCheck) collect(mounts []*mount, filter *compiledFilter) (devices []*diskResult, unresponsive, skipped []string) {
+	var selected []*mount
+	for _, m := range mounts {
+		if filter.match(m) {
+			selected = append(selected, m)
+		}
+	}
+	for _, m := range dedupe(selected) {
+		stats, err := statfsTimeout(c.statfs, m.mountPoint, c.timeout)
+		if err != nil {
+			if c.skipStale && m.isNetwork() && isStale(err) {
+				skipped = append(skipped, m.mountPoint)
+				continue
+			}
+			if err == errTimeout {
+				err = fmt.Errorf("did not answer within %v", c.timeout)
+			}
+			unresponsive = append(unresponsive, fmt.Sprintf("  %s mount %s of %s: %s\n", m.fsType, m.mountPoint, m.source, err))
 			continue
 		}
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
+		if stats.size == 0 {
 			continue
 		}
-		device := &diskResult{
-			filesystem: fields[0],
-			deviceType: fields[1],
-			blocks:     toInt64(fields[2]),
-			used:       toInt64(fields[3]),
-			available:  toInt64(fields[4]),
-			capacity:   toIntFromPercent(fields[5]),
-			mounted:    fields[6],
+		devices = append(devices, toDiskResult(m, stats))
+	}
+	return devices, unresponsive, skipped
+}
+
+// readOnly returns a problem line for each checked filesystem that went
+// read-only on errors, or is mounted read-only on a mount point matching
+// --expect-rw. The mount points of a device with the same problem, such as
+// the bind mounts of a filesystem remounted read-only, share its line.
+func (c *diskCheck) readOnly(mounts []*mount, filter *compiledFilter) []string {
+	var problems []string
+	var grouped [][]*mount
+	index := make(map[string]int)
+	for _, m := range mounts {
+		if !filter.match(m) {
+			continue
+		}
+		var problem string
+		switch {
+		case m.remountedReadOnly():
+			problem = "remounted read-only, check the kernel log for errors"
+		case c.expectRW != nil && c.expectRW.MatchString(m.mountPoint) && m.readOnly():
+			problem = "read-only, expected read-write"
+		default:
+			continue
+		}
+		key := m.device + " " + problem
+		if m.device == "" {
+			key = m.mountPoint + " " + problem
+		}
+		if i, ok := index[key]; ok {
+			// the shortest mount point leads, as in dedupe
+			if len(m.mountPoint) < len(grouped[i][0].mountPoint) {
+				grouped[i] = append([]*mount{m}, grouped[i]...)
+			} else {
+				grouped[i] = append(grouped[i], m)
+			}
+			continue
+		}
+		index[key] = len(problems)
+		problems = append(problems, problem)
+		grouped = append(grouped, []*mount{m})
+	}
+
+	lines := make([]string, len(problems))
+	for i, group := range grouped {
+		m := group[0]
+		also := ""
+		if len(group) > 1 {
+			var others []string
+			for _, other := range group[1:] {
+				others = append(others, other.mountPoint)
+			}
+			also = fmt.Sprintf(" (also on %s)", strings.Join(others, ", "))
+		}
+		lines[i] = fmt.Sprintf("  %s mount %s of %s%s: %s\n", m.fsType, m.mountPoint, m.source, also, problems[i])
+	}
+	return lines
+}
+
+// regexpValue is a flag holding a regex compiled when the command line is
+// parsed, so that an invalid one is reported there rather than by each run.
+type regexpValue struct {
+	r **regexp.Regexp
+}
+
+func (v regexpValue) Set(expr string) error {
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	*v.r = r
+	return nil
+}
+
+func (v regexpValue) String() string {
+	if *v.r == nil {
+		return ""
+	}
+	return (*v.r).String()
+}
+
+// missing returns a problem line for each filesystem of the fstab, and each
+// expected mount point, that is not mounted. Filesystems left out by the
+// mount filter are not checked.
+func (c *diskCheck) missing(mounts []*mount, filter *compiledFilter) ([]string, error) {
+	var expected []*mount
+	if c.fstab != "" {
+		fstab, err := readFstab(c.fstab)
+		if err != nil {
+			return nil, err
 		}
+		for _, m := range fstab {
+			if filter.match(m) {
+				expected = append(expected, m)
+			}
+		}
+	}
+	for _, mountPoint := range c.expectMounts {
+		expected = append(expected, &mount{mountPoint: path.Clean(mountPoint)})
+	}
+
+	mounted := make(map[string]bool)
+	for _, m := range mounts {
+		mounted[m.mountPoint] = true
+	}
+	var problems []string
+	for _, m := range expected {
+		if mounted[m.mountPoint] {
+			continue
+		}
+		// a second expectation of the same mount point is reported once
+		mounted[m.mountPoint] = true
+		device := &diskResult{filesystem: m.source, mounted: m.mountPoint}
 		fillUseType(device)
-		devices[i-1] = device
-		fmt.Fprintln(&buf, "  ", line)
+		if m.source == "" {
+			problems = append(problems, fmt.Sprintf("  %v mount %s is not mounted\n", device.usage.string(), m.mountPoint))
+		} else {
+			problems = append(problems, fmt.Sprintf("  %v mount %s of %s is not mounted\n", device.usage.string(), m.mountPoint, m.source))
+		}
+	}
+	return problems, nil
+}
+
+// probe runs the write probes and returns a problem line for each failed
+// one.
+func (c *diskCheck) probe() []string {
+	var problems []string
+	for _, dir := range c.writeProbes {
+		err := writeProbe(dir, c.timeout)
+		if err == errTimeout {
+			err = fmt.Errorf("did not answer within %v", c.timeout)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("  write probe in %s: %s\n", dir, err))
+		}
+	}
+	return problems
+}
+
+// toDiskResult converts a statfs the way df -P reports it, in 1024 byte
+// blocks with the capacity rounded up.
+func toDiskResult(m *mount, stats *fsStats) *diskResult {
+	device := &diskResult{
+		filesystem: m.source,
+		deviceType: m.fsType,
+		blocks:     int64(stats.size / 1024),
+		used:       int64((stats.size - stats.free) / 1024),
+		available:  int64(stats.available / 1024),
+		mounted:    m.mountPoint,
+	}
+	device.capacity = percentUsed(device.used, device.used+device.available)
+	if stats.inodes > 0 {
+		device.hasInodes = true
+		device.inodes = int64(stats.inodes)
+		device.inodesFree = int64(stats.freeNodes)
+		device.inodesUsed = device.inodes - device.inodesFree
+		device.inodeCapacity = percentUsed(device.inodesUsed, device.inodes)
+	}
+	fillUseType(device)
+	return device
+}
+
+func percentUsed(used, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	return int((used*100 + total - 1) / total)
+}
+
+// formatDevices renders the devices as a df -PT table.
+func formatDevices(devices []*diskResult) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "Filesystem\tType\t1024-blocks\tUsed\tAvailable\tCapacity\t")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d%%\t\n", d.filesystem, d.deviceType, d.blocks, d.used, d.available, d.capacity)
 	}
-	return devices, buf.String()
+	w.Flush()
+	var out bytes.Buffer
+	for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		mounted := "Mounted on"
+		if i > 0 {
+			mounted = devices[i-1].mounted
+		}
+		fmt.Fprintf(&out, "   %s %s\n", line, mounted)
+	}
+	return out.String()
 }
 
-func summarize(devices []*diskResult, critical, warning int) (int, int, string) {
+func summarize(devices []*diskResult, critical, warning, inodeCritical, inodeWarning *check.Range) (int, int, string) {
 	var problemMessages bytes.Buffer
 	critCount := 0
 	warnCount := 0
@@ -111,20 +455,54 @@ func summarize(devices []*diskResult, critical, warning int) (int, int, string)
 		if device == nil {
 			continue
 		}
-		switch {
-		case device.capacity >= critical:
+		warn, crit := device.levels(warning, critical)
+		switch check.Evaluate(float64(device.capacity), warn, crit) {
+		case nagios.NAGIOS_CRITICAL:
 			fmt.Fprintln(&problemMessages, device.string())
 			critCount++
-		case device.capacity >= warning:
+		case nagios.NAGIOS_WARNING:
 			fmt.Fprintln(&problemMessages, device.string())
 			warnCount++
 		}
+		if !device.hasInodes {
+			continue
+		}
+		switch check.Evaluate(float64(device.inodeCapacity), inodeWarning, inodeCritical) {
+		case nagios.NAGIOS_CRITICAL:
+			fmt.Fprintln(&problemMessages, device.inodeString())
+			critCount++
+		case nagios.NAGIOS_WARNING:
+			fmt.Fprintln(&problemMessages, device.inodeString())
+			warnCount++
+		}
 	}
 	return critCount, warnCount, problemMessages.String()
 }
 
-func doCheck(critCount, warnCount int, outputText, problems string) *nagios.NagiosStatus {
-	status := &nagios.NagiosStatus{}
+// summarizeFree checks the available KB of the devices against the free
+// space levels.
+func summarizeFree(devices []*diskResult, critical, warning *check.Range) (int, int, string) {
+	var problemMessages bytes.Buffer
+	critCount := 0
+	warnCount := 0
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		switch check.Evaluate(float64(device.available), warning, critical) {
+		case nagios.NAGIOS_CRITICAL:
+			fmt.Fprintln(&problemMessages, device.freeString())
+			critCount++
+		case nagios.NAGIOS_WARNING:
+			fmt.Fprintln(&problemMessages, device.freeString())
+			warnCount++
+		}
+	}
+	return critCount, warnCount, problemMessages.String()
+}
+
+func doCheck(critCount, warnCount int, outputText, problems string) *check.Status {
+	status := &check.Status{}
 	switch {
 	case critCount > 0:
 		status.Value = nagios.NAGIOS_CRITICAL
@@ -145,20 +523,29 @@ func doCheck(critCount, warnCount int, outputText, problems string) *nagios.Nagi
 	return status
 }
 
-func toInt64(str string) int64 {
-	result, err := strconv.ParseInt(str, 10, 64)
-	if err != nil {
-		nagios.Unknown(err.Error())
-	}
-	return result
-}
-
-func toIntFromPercent(str string) int {
-	result, err := strconv.Atoi(str[:len(str)-1])
-	if err != nil {
-		nagios.Unknown(err.Error())
+func perfdata(devices []*diskResult, critical, warning, inodeCritical, inodeWarning, freeCritical, freeWarning *check.Range) []*check.Perfdata {
+	var metrics []*check.Perfdata
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		labels := map[string]string{"mount": device.mounted, "device": device.filesystem, "usage": device.usage.string()}
+		warn, crit := device.levels(warning, critical)
+		metrics = append(metrics,
+			check.NewPerfdata(device.mounted, float64(device.capacity), "%").Thresholds(warn, crit).Bounds(0, 100).Metric("capacity", labels),
+			check.NewPerfdata(device.mounted+" used", float64(device.used), "KB").Bounds(0, float64(device.blocks)).Metric("used", labels),
+			check.NewPerfdata(device.mounted+" available", float64(device.available), "KB").Thresholds(freeWarning, freeCritical).Bounds(0, float64(device.blocks)).Metric("available", labels),
+			check.NewPerfdata(device.mounted+" size", float64(device.blocks), "KB").Minimum(0).Metric("size", labels),
+		)
+		if device.hasInodes {
+			metrics = append(metrics,
+				check.NewPerfdata(device.mounted+" inodes", float64(device.inodeCapacity), "%").Thresholds(inodeWarning, inodeCritical).Bounds(0, 100).Metric("inode_capacity", labels),
+				check.NewPerfdata(device.mounted+" inodes used", float64(device.inodesUsed), "").Bounds(0, float64(device.inodes)).Metric("inodes_used", labels),
+				check.NewPerfdata(device.mounted+" inodes free", float64(device.inodesFree), "").Bounds(0, float64(device.inodes)).Metric("inodes_free", labels),
+			)
+		}
 	}
-	return result
+	return metrics
 }
 
 func fillUseType(device *diskResult) {
@@ -173,5 +560,36 @@ func fillUseType(device *diskResult) {
 }
 
 func (d *diskResult) string() string {
+	var notes []string
+	if d.rule != nil {
+		notes = append(notes, d.rule.name)
+	}
+	if d.scale != 0 && d.scale != 1 {
+		notes = append(notes, fmt.Sprintf("levels scaled by %.2f for its size", d.scale))
+	}
+	if len(notes) > 0 {
+		return fmt.Sprintf("  %v device %v is at %v%% capacity (%s).", d.usage.string(), d.filesystem, d.capacity, strings.Join(notes, ", "))
+	}
 	return fmt.Sprintf("  %v device %v is at %v%% capacity.", d.usage.string(), d.filesystem, d.capacity)
 }
+
+func (d *diskResult) freeString() string {
+	return fmt.Sprintf("  %v device %v has %v free.", d.usage.string(), d.filesystem, formatKB(d.available))
+}
+
+// formatKB renders a KB count in the largest binary unit it reaches, such
+// as 8.5GiB.
+func formatKB(kb int64) string {
+	value := float64(kb)
+	for _, unit := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if value < 1024 {
+			return fmt.Sprintf("%.1f%s", value, unit)
+		}
+		value /= 1024
+	}
+	return fmt.Sprintf("%.1fPiB", value)
+}
+
+func (d *diskResult) inodeString() string {
+	return fmt.Sprintf("  %v device %v is at %v%% inode capacity.", d.usage.string(), d.filesystem, d.inodeCapacity)
+}
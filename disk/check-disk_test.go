@@ -1,24 +1,74 @@
-package main
+package disk
 
 import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/alecthomas/units"
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-const sampleData = `Filesystem     Type 1024-blocks     Used Available Capacity Mounted on
-/dev/xvda1     ext4    20511356  3854292  15717948      20% /
-/dev/xvdb      ext3    38565344 15262992  21336684      42% /mnt
-/dev/xvdd1     xfs     41819168 15450200  26368968      37% /var/lib/ceph/osd/ceph-0
-/dev/xvdf1     xfs     41819168 12089480  29729688      29% /var/lib/ceph/osd/ceph-2
-/dev/xvde1     xfs     41819168 14816796  27002372      36% /var/lib/ceph/osd/ceph-1
-/dev/rbd1      xfs      1011008   122792    888216      13% /opt/acaleph-internal/mysql
-/dev/rbd2      xfs      1011008    44928    966080       5% /opt/acaleph-internal/redis
-/dev/rbd3      xfs     30704992    35712  30669280       1% /opt/acaleph-internal/graphite
-/dev/rbd4      xfs     30704992  3746240  26958752      13% /opt/acaleph-internal/logstash
-/dev/rbd5      xfs     30704992  2785432  27919560      10% /opt/acaleph-internal/influxdb`
-
-func TestParseOutput(t *testing.T) {
+var fixture = &check.Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/sys"}
+
+// sampleStats are the statfs of the fixture mounts, /srv/backup hangs.
+var sampleStats = map[string]*fsStats{
+	"/":                           {size: 20511356 * 1024, free: (20511356 - 3854292) * 1024, available: 15717948 * 1024, inodes: 1310720, freeNodes: 65536},
+	"/sys":                        {},
+	"/proc":                       {},
+	"/mnt":                        {size: 38565344 * 1024, free: 23302352 * 1024, available: 21336684 * 1024, inodes: 2444624, freeNodes: 2432279},
+	"/var/lib/ceph/osd/ceph-0":    {size: 41819168 * 1024, free: 26368968 * 1024, available: 26368968 * 1024, inodes: 20971520, freeNodes: 20971000},
+	"/opt/acaleph-internal/mysql": {size: 1011008 * 1024, free: 888216 * 1024, available: 888216 * 1024, inodes: 512000, freeNodes: 511000},
+	"/srv/my data":                {size: 1024 * 1024, free: 1024 * 1024, available: 1024 * 1024},
+}
+
+func fakeStatfs(path string) (*fsStats, error) {
+	if path == "/srv/backup" {
+		time.Sleep(time.Second)
+	}
+	stats, ok := sampleStats[path]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return stats, nil
+}
+
+func newCheck() *diskCheck {
+	return &diskCheck{
+		warnLevel: check.MustParseRange("85"),
+		critLevel: check.MustParseRange("95"),
+		filter:    mountFilter{excludeType: defaultExcludeType},
+		timeout:   50 * time.Millisecond,
+		procfs:    fixture,
+		statfs:    fakeStatfs,
+	}
+}
+
+func TestParseMountinfo(t *testing.T) {
+	mounts, err := readMounts(fixture)
+	if err != nil {
+		t.Fatal("sample mountinfo should parse:", err)
+	}
+	if len(mounts) != 12 {
+		t.Fatalf("expected 12 mounts, %d parsed.", len(mounts))
+	}
+	if m := mounts[5]; m.mountPoint != "/mnt" || m.fsType != "ext4" || m.source != "/dev/xvdc" {
+		t.Errorf("/mnt should be the last mount over it, is %+v.", m)
+	}
+	if m := mounts[9]; m.mountPoint != "/srv/my data" {
+		t.Errorf("mount points should be unescaped, got %q.", m.mountPoint)
+	}
+	if _, err := parseMountinfo("22 0 202:1 / / rw,relatime\n"); err == nil {
+		t.Error("mountinfo without the separator should be invalid.")
+	}
+}
+
+func TestCollect(t *testing.T) {
 	expectedDevice := &diskResult{
 		filesystem: "/dev/xvda1",
 		deviceType: "ext4",
@@ -29,10 +79,13 @@ func TestParseOutput(t *testing.T) {
 		mounted:    "/",
 	}
 
-	devices, outputText := parseResult(sampleData)
+	c := newCheck()
+	mounts, _ := readMounts(fixture)
+	filter, _ := c.filter.compile()
+	devices, unresponsive, skipped := c.collect(mounts, filter)
 
-	if len(devices) != 10 || outputText == "" {
-		t.Errorf("expected 10 devices, %d parsed.", len(devices))
+	if len(devices) != 5 || len(unresponsive) != 1 || len(skipped) != 0 {
+		t.Fatalf("expected 5 devices and 1 unresponsive mount, got %d and %v.", len(devices), unresponsive)
 	}
 	sample := devices[0]
 	if sample.filesystem != expectedDevice.filesystem {
@@ -53,6 +106,87 @@ func TestParseOutput(t *testing.T) {
 	if sample.capacity != expectedDevice.capacity {
 		t.Errorf("expected capacity type is %d, capacity is %d.", expectedDevice.capacity, sample.capacity)
 	}
+	if !sample.hasInodes || sample.inodesUsed != 1245184 || sample.inodeCapacity != 95 {
+		t.Errorf("unexpected inode usage of /: %+v", sample)
+	}
+	if devices[4].hasInodes {
+		t.Error("btrfs has no fixed inode count and should not be checked.")
+	}
+	if devices[2].usage != osd || devices[3].usage != rbd {
+		t.Error("ceph osd and rbd mounts should be recognized.")
+	}
+	if unresponsive[0] != "  nfs4 mount /srv/backup of nas:/export/backup: did not answer within 50ms\n" {
+		t.Errorf("unexpected problem %q.", unresponsive[0])
+	}
+
+	c.skipStale = true
+	if _, unresponsive, skipped := c.collect(mounts, filter); len(unresponsive) != 0 || len(skipped) != 1 {
+		t.Errorf("the hung nfs mount should be skipped, got %v and %v.", unresponsive, skipped)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	mounts, _ := readMounts(fixture)
+	if m := mounts[10]; m.device != "202:1" || m.mountPoint != "/var/lib/kubelet/pods/abc/volumes/data" {
+		t.Fatalf("expected the bind mount of /dev/xvda1, got %+v.", m)
+	}
+	kept := dedupe(mounts)
+	if len(kept) != 11 || kept[3].mountPoint != "/" {
+		t.Errorf("the bind mount should give way to /, got %d mounts.", len(kept))
+	}
+	for _, m := range kept {
+		if m.mountPoint == "/var/lib/kubelet/pods/abc/volumes/data" {
+			t.Error("the bind mount should be dropped.")
+		}
+	}
+
+	// the shortest mount point wins whichever comes first
+	bindFirst := dedupe([]*mount{mounts[10], mounts[3]})
+	if len(bindFirst) != 1 || bindFirst[0].mountPoint != "/" {
+		t.Errorf("expected / to be kept, got %+v.", bindFirst)
+	}
+}
+
+func TestMountFilter(t *testing.T) {
+	mounts, _ := readMounts(fixture)
+	for filter, expected := range map[mountFilter]int{
+		mountFilter{}: 12,
+		mountFilter{includeMount: "^/var/lib/ceph/"}:               1,
+		mountFilter{excludeMount: "^/(sys|proc|run)$"}:             9,
+		mountFilter{includeType: "^(ext[34]|xfs)$"}:                5,
+		mountFilter{excludeType: "^(tmpfs|devtmpfs|sysfs|proc)$"}:  8,
+		mountFilter{includeDevice: "^/dev/", excludeDevice: "rbd"}: 5,
+	} {
+		compiled, err := filter.compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, m := range mounts {
+			if compiled.match(m) {
+				count++
+			}
+		}
+		if count != expected {
+			t.Errorf("expected %+v to match %d mounts, matched %d.", filter, expected, count)
+		}
+	}
+	if _, err := (&mountFilter{includeMount: "("}).compile(); err == nil {
+		t.Error("invalid regex should be rejected.")
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := newCheck()
+	c.inodeCritLevel = check.MustParseRange("90")
+	c.skipStale = true
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("95%% inodes used on / should be CRITICAL, status is %v.", status)
+	}
+	if !strings.Contains(status.Message, "   /dev/xvda1 ext4  20511356    3854292  15717948  20%       /\n") || !strings.Contains(status.Message, "Skipped stale mounts: /srv/backup") {
+		t.Errorf("unexpected message %q.", status.Message)
+	}
 }
 
 func TestSummarizePass(t *testing.T) {
@@ -67,7 +201,7 @@ func TestSummarizePass(t *testing.T) {
 			capacity: 20,
 		},
 	}
-	crit, warn, probs := summarize(devices, 90, 80)
+	crit, warn, probs := summarize(devices, check.MustParseRange("90"), check.MustParseRange("80"), nil, nil)
 	if crit > 0 || warn > 0 || probs != "" {
 		t.Error("check should have passed but some haved failed:", devices)
 	}
@@ -87,7 +221,7 @@ func TestSummarizeWarn(t *testing.T) {
 			capacity: 20,
 		},
 	}
-	crit, warn, probs := summarize(devices, 90, 80)
+	crit, warn, probs := summarize(devices, check.MustParseRange("90"), check.MustParseRange("80"), nil, nil)
 	if crit > 0 || warn != 1 || probs == "" {
 		t.Error("Should only have 1 warning and 2 passing", devices)
 	}
@@ -109,7 +243,7 @@ func TestSummarizeFail(t *testing.T) {
 			capacity: 20,
 		},
 	}
-	crit, warn, probs := summarize(devices, 90, 80)
+	crit, warn, probs := summarize(devices, check.MustParseRange("90"), check.MustParseRange("80"), nil, nil)
 	if crit != 1 || warn != 1 || probs == "" {
 		t.Error("Should have 1 warning, 1 critical and 1 passing", devices)
 	}
@@ -135,3 +269,228 @@ func TestDoCheckFail(t *testing.T) {
 		t.Error("status should be CRITICAL")
 	}
 }
+
+func TestSummarizeInodes(t *testing.T) {
+	devices := []*diskResult{
+		&diskResult{
+			capacity:      20,
+			usage:         system,
+			filesystem:    "/dev/sdx",
+			hasInodes:     true,
+			inodeCapacity: 96,
+		},
+		&diskResult{
+			capacity:      20,
+			inodeCapacity: 99,
+		},
+	}
+	crit, warn, probs := summarize(devices, check.MustParseRange("90"), check.MustParseRange("80"), check.MustParseRange("95"), check.MustParseRange("85"))
+	if crit != 1 || warn != 0 || probs != "  SYSTEM device /dev/sdx is at 96% inode capacity.\n" {
+		t.Errorf("Should have 1 critical inode usage, got %d critical, %d warning: %q", crit, warn, probs)
+	}
+}
+
+func TestLevelRules(t *testing.T) {
+	c := newCheck()
+	c.mountRules = []string{"^/var/lib/ceph/osd/ceph-1$=,99"}
+	c.typeRules = []string{"osd=70,80"}
+	rules, err := c.rules()
+	if err != nil {
+		t.Fatal("rules should parse:", err)
+	}
+	devices := []*diskResult{
+		&diskResult{capacity: 90, usage: osd, filesystem: "/dev/sdb1", mounted: "/var/lib/ceph/osd/ceph-1"},
+		&diskResult{capacity: 75, usage: osd, filesystem: "/dev/sdc1", mounted: "/var/lib/ceph/osd/ceph-2"},
+		&diskResult{capacity: 75, usage: system, filesystem: "/dev/sda1", mounted: "/"},
+	}
+	applyRules(devices, rules)
+	crit, warn, probs := summarize(devices, c.critLevel, c.warnLevel, nil, nil)
+	expected := "  OSD device /dev/sdc1 is at 75% capacity (type OSD).\n"
+	if crit != 0 || warn != 1 || probs != expected {
+		t.Errorf("expected 1 warning %q, got %d critical, %d warning: %q", expected, crit, warn, probs)
+	}
+
+	for _, spec := range []string{"OSD", "OSD=80", "DATA=70,80", "OSD=x,80"} {
+		if _, err := parseTypeRule(spec); err == nil {
+			t.Errorf("expected an error parsing %q", spec)
+		}
+	}
+	if _, err := parseMountRule("[=70,80"); err == nil {
+		t.Error("expected an error for a bad mount pattern")
+	}
+}
+
+func TestSummarizeFree(t *testing.T) {
+	warnFree, _ := freeLevel(10 * units.GiB)
+	critFree, _ := freeLevel(5 * units.GiB)
+	devices := []*diskResult{
+		&diskResult{usage: system, filesystem: "/dev/sda1", available: 4 * 1024 * 1024},
+		&diskResult{usage: osd, filesystem: "/dev/sdb1", available: 8*1024*1024 + 512*1024},
+		&diskResult{usage: osd, filesystem: "/dev/sdc1", available: 10 * 1024 * 1024},
+	}
+	crit, warn, probs := summarizeFree(devices, critFree, warnFree)
+	expected := "  SYSTEM device /dev/sda1 has 4.0GiB free.\n  OSD device /dev/sdb1 has 8.5GiB free.\n"
+	if crit != 1 || warn != 1 || probs != expected {
+		t.Errorf("expected 1 critical and 1 warning %q, got %d critical, %d warning: %q", expected, crit, warn, probs)
+	}
+	if level, _ := freeLevel(0); level.IsSet() {
+		t.Error("expected no free level for 0")
+	}
+}
+
+func TestMagicScale(t *testing.T) {
+	if scale := magicScale(20*1024*1024, 0.8, 20*units.GiB); scale != 1 {
+		t.Errorf("expected a filesystem of the base size to be unscaled, got %v", scale)
+	}
+	large := &diskResult{usage: osd, filesystem: "/dev/sdb1", capacity: 96, blocks: 100 * 1024 * 1024 * 1024}
+	large.scale = magicScale(large.blocks, 0.8, 20*units.GiB)
+	warn, crit := large.levels(check.MustParseRange("85"), check.MustParseRange("95"))
+	if warn.String() != "97.3" || crit.String() != "99.1" {
+		t.Errorf("expected levels 97.3 and 99.1 for 100TiB, got %v and %v", warn, crit)
+	}
+	crit2, warn2, probs := summarize([]*diskResult{large}, check.MustParseRange("95"), check.MustParseRange("85"), nil, nil)
+	if crit2 != 0 || warn2 != 0 || probs != "" {
+		t.Errorf("expected a 100TiB filesystem at 96%% to pass, got %d critical, %d warning: %q", crit2, warn2, probs)
+	}
+
+	for spec, expected := range map[string]string{"85": "92.5", "~:80": "~:90", "10:": "10:", "@80:90": "@80:90"} {
+		if scaled := scaleLevel(check.MustParseRange(spec), 0.5); scaled.String() != expected {
+			t.Errorf("expected %s scaled by 0.5 to be %s, got %s", spec, expected, scaled)
+		}
+	}
+}
+
+func TestFitTrend(t *testing.T) {
+	samples := []usageSample{{Time: 0, Used: 100}, {Time: 10, Used: 110}, {Time: 20, Used: 120}}
+	if slope, ok := fitTrend(samples); !ok || slope != 1 {
+		t.Errorf("expected a slope of 1, got %v, %v", slope, ok)
+	}
+	if _, ok := fitTrend(samples[:1]); ok {
+		t.Error("a single sample should have no trend")
+	}
+}
+
+func TestTrend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCheck()
+	c.state = &check.StateStore{Dir: dir, Key: "disk", Procfs: fixture, Persistent: true}
+	c.trendWindow = 24 * time.Hour
+	start := time.Unix(1440600000, 0)
+	const size = 100 * 1024 * 1024
+	var devices []*diskResult
+	for hour := 0; hour < 3; hour++ {
+		c.now = func() time.Time { return start.Add(time.Duration(hour) * time.Hour) }
+		used := int64(size * (70 + 5*hour) / 100)
+		devices = []*diskResult{
+			&diskResult{usage: osd, filesystem: "/dev/sdb1", mounted: "/var/lib/ceph/osd/ceph-1", blocks: size, used: used, available: size - used},
+			&diskResult{usage: system, filesystem: "/dev/sda1", mounted: "/", blocks: size, used: size * 9 / 10, available: size / 10},
+		}
+		if err := c.trend(devices); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	left, ok := devices[0].timeToFull()
+	if !ok || left != 4*time.Hour {
+		t.Errorf("expected 4h to full, got %v, %v", left, ok)
+	}
+	if _, ok := devices[1].timeToFull(); ok {
+		t.Error("a static device should have no time to full")
+	}
+	crit, warn, probs := summarizeFill(devices, check.MustParseRange("21600:"), check.MustParseRange("86400:"))
+	expected := "  OSD device /dev/sdb1 will be full in 4h0m, growing 5.0GiB/h.\n"
+	if crit != 1 || warn != 0 || probs != expected {
+		t.Errorf("expected 1 critical %q, got %d critical, %d warning: %q", expected, crit, warn, probs)
+	}
+	if out := formatFill(devices); out != "   Time to full: /var/lib/ceph/osd/ceph-1 4h0m\n" {
+		t.Errorf("unexpected estimate %q", out)
+	}
+
+	// 500KB over 30 days with 80GB free projects past what a time.Duration
+	// holds, which must read as not filling rather than wrap negative
+	slow := &diskResult{usage: system, filesystem: "/dev/sda1", mounted: "/", available: 80 * 1024 * 1024, hasTrend: true, growth: 500.0 / (30 * 24 * 3600)}
+	if left, ok := slow.timeToFull(); ok {
+		t.Errorf("a slowly growing device should not be filling, got %v", left)
+	}
+	if crit, warn, _ := summarizeFill([]*diskResult{slow}, check.MustParseRange("3600:"), nil); crit != 0 || warn != 0 {
+		t.Errorf("a slowly growing device should not alert, got %d critical, %d warning", crit, warn)
+	}
+	if metrics := trendPerfdata([]*diskResult{slow}, nil, nil); len(metrics) != 0 {
+		t.Errorf("a slowly growing device should have no time to full, got %v", check.FormatPerfdata(metrics))
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	mounts, err := parseMountinfo(`22 0 202:1 / / rw,relatime shared:1 - ext4 /dev/xvda1 rw,data=ordered
+47 22 202:33 / /data rw,relatime shared:30 - ext4 /dev/xvdc1 ro,errors=remount-ro
+48 22 202:34 / /archive ro,relatime shared:31 - ext4 /dev/xvdc2 ro
+49 22 7:0 / /snap/core ro,nodev,relatime shared:32 - squashfs /dev/loop0 ro
+50 22 202:33 /docker /var/lib/docker/volumes/db rw,relatime shared:30 - ext4 /dev/xvdc1 ro,errors=remount-ro
+51 22 202:33 /kubelet /var/lib/kubelet/pods/abc/volumes/db rw,relatime shared:30 - ext4 /dev/xvdc1 ro,errors=remount-ro
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCheck()
+	filter, _ := c.filter.compile()
+	problems := c.readOnly(mounts, filter)
+	expected := "  ext4 mount /data of /dev/xvdc1 (also on /var/lib/docker/volumes/db, /var/lib/kubelet/pods/abc/volumes/db): remounted read-only, check the kernel log for errors\n"
+	if len(problems) != 1 || problems[0] != expected {
+		t.Errorf("expected /data and its bind mounts remounted read-only on one line, got %q.", problems)
+	}
+
+	c.expectRW = regexp.MustCompile("^/(data|archive)$")
+	if problems := c.readOnly(mounts, filter); len(problems) != 2 || !strings.Contains(problems[1], "/archive of /dev/xvdc2: read-only, expected read-write") {
+		t.Errorf("expected /archive to be read-only, got %q.", problems)
+	}
+	if err := (regexpValue{&c.expectRW}).Set("^/(data"); err == nil {
+		t.Error("an invalid --expect-rw should fail when the flag is parsed.")
+	}
+}
+
+func TestWriteProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCheck()
+	c.writeProbes = []string{dir, dir + "/missing"}
+	problems := c.probe()
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "  write probe in "+dir+"/missing: ") {
+		t.Errorf("expected the missing directory to fail, got %q.", problems)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("the probe should clean up after itself, found %d files.", len(files))
+	}
+}
+
+func TestMissing(t *testing.T) {
+	mounts, _ := readMounts(fixture)
+	c := newCheck()
+	c.fstab = "testdata/fstab"
+	c.expectMounts = []string{"/mnt/", "/var/lib/ceph/osd/ceph-1", "/srv/data"}
+	filter, _ := c.filter.compile()
+	problems, err := c.missing(mounts, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"  OSD mount /var/lib/ceph/osd/ceph-1 of /dev/xvde1 is not mounted\n",
+		"  SYSTEM mount /srv/data is not mounted\n",
+	}
+	if strings.Join(problems, "") != strings.Join(expected, "") {
+		t.Errorf("expected %q, got %q.", expected, problems)
+	}
+
+	c.fstab = "testdata/missing"
+	if _, err := c.missing(mounts, filter); err == nil {
+		t.Error("a missing fstab should be an error.")
+	}
+}
@@ -0,0 +1,355 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// IODefinition is the diskio subcommand.
+var IODefinition = &check.Definition{
+	Name:     "diskio",
+	Help:     "Check utilization, latency and queue size of block devices.",
+	Register: registerIO,
+}
+
+// diskstats counters, counted from the reads completed field
+const (
+	readsCompleted = iota
+	readsMerged
+	sectorsRead
+	msReading
+	writesCompleted
+	writesMerged
+	sectorsWritten
+	msWriting
+	iosInProgress
+	msDoingIO
+	weightedMsDoingIO
+	diskstatsFields
+)
+
+// sectorSize is the unit of the diskstats sector counts, whatever the
+// device's own sector size.
+const sectorSize = 512
+
+type ioCheck struct {
+	utilWarnLevel  *check.Range
+	utilCritLevel  *check.Range
+	awaitWarnLevel *check.Range
+	awaitCritLevel *check.Range
+	queueWarnLevel *check.Range
+	queueCritLevel *check.Range
+	includeDevice  string
+	excludeDevice  string
+	interval       time.Duration
+	stateful       bool
+	state          *check.StateStore
+	procfs         *check.Procfs
+}
+
+func registerIO(flags check.FlagSet) check.Check {
+	c := &ioCheck{
+		utilWarnLevel:  check.RangeFlag(flags.Flag("util-warn-level", "warn range for the percentage of time a device is busy").Default("80")),
+		utilCritLevel:  check.RangeFlag(flags.Flag("util-crit-level", "crit range for the percentage of time a device is busy").Default("95")),
+		awaitWarnLevel: check.RangeFlag(flags.Flag("await-warn-level", "warn range for the average time in ms an IO takes, queueing included")),
+		awaitCritLevel: check.RangeFlag(flags.Flag("await-crit-level", "crit range for the average time in ms an IO takes, queueing included")),
+		queueWarnLevel: check.RangeFlag(flags.Flag("queue-warn-level", "warn range for the average number of IOs queued or in progress")),
+		queueCritLevel: check.RangeFlag(flags.Flag("queue-crit-level", "crit range for the average number of IOs queued or in progress")),
+		procfs:         check.ProcfsFlags(flags),
+	}
+	c.state = check.StateFlags(flags, c.procfs, "diskio")
+	flags.Flag("include-device", "Only check devices whose name, such as sda, matches this regex").StringVar(&c.includeDevice)
+	flags.Flag("exclude-device", "Skip devices whose name matches this regex").Default(`^(loop|ram|zram|sr|fd)\d+$`).StringVar(&c.excludeDevice)
+	flags.Flag("interval", "Time between two samples of /proc/diskstats").Default("1s").DurationVar(&c.interval)
+	flags.Flag("stateful", "Compare against the counters saved by the previous run, if at least an interval ago, instead of sampling").BoolVar(&c.stateful)
+	return c
+}
+
+func (c *ioCheck) Run() *check.Status {
+	mounts, err := readMounts(c.procfs)
+	if err != nil {
+		return check.Unknown(err)
+	}
+
+	var stats []*deviceIO
+	if c.stateful {
+		if stats, err = c.sinceLastRun(); err != nil {
+			return check.Unknown(err)
+		}
+	}
+	if stats == nil {
+		if stats, err = c.sample(); err != nil {
+			return check.Unknown(err)
+		}
+	}
+
+	devices, err := c.selectDevices(stats, mounts)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	return c.evaluate(devices)
+}
+
+// selectDevices filters the devices by name and classes the ones kept.
+func (c *ioCheck) selectDevices(stats []*deviceIO, mounts []*mount) ([]*deviceIO, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if c.includeDevice != "" {
+		if include, err = regexp.Compile(c.includeDevice); err != nil {
+			return nil, err
+		}
+	}
+	if c.excludeDevice != "" {
+		if exclude, err = regexp.Compile(c.excludeDevice); err != nil {
+			return nil, err
+		}
+	}
+	var selected []*deviceIO
+	for _, d := range stats {
+		if (include == nil || include.MatchString(d.name)) && (exclude == nil || !exclude.MatchString(d.name)) {
+			d.usage = deviceUseType(d.name, mounts)
+			selected = append(selected, d)
+		}
+	}
+	return selected, nil
+}
+
+// sample reads /proc/diskstats twice an interval apart.
+func (c *ioCheck) sample() ([]*deviceIO, error) {
+	before, err := readDiskstats(c.procfs)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	time.Sleep(c.interval)
+	after, err := readDiskstats(c.procfs)
+	if err != nil {
+		return nil, err
+	}
+	if c.stateful {
+		if err := c.state.Save(after); err != nil {
+			return nil, err
+		}
+	}
+	return measureIO(before, after, time.Since(start).Seconds()), nil
+}
+
+// sinceLastRun returns the IO since the counters saved by the previous run,
+// and saves the current ones. It returns nil on the first run after a boot
+// or if the previous run is less than an interval ago.
+func (c *ioCheck) sinceLastRun() ([]*deviceIO, error) {
+	after, err := readDiskstats(c.procfs)
+	if err != nil {
+		return nil, err
+	}
+	before := make(diskstats)
+	at, found, err := c.state.Swap(after, &before)
+	if err != nil {
+		return nil, err
+	}
+	if !found || time.Since(at) < c.interval {
+		return nil, nil
+	}
+	return measureIO(before, after, time.Since(at).Seconds()), nil
+}
+
+// counterWrap is where the diskstats counters, unsigned longs, wrap around.
+// Only 32 bit ones ever do: a 64 bit counter that went down was reset, as
+// when a device is removed and added again under the same name.
+var counterWrap uint64
+
+func init() {
+	if strconv.IntSize == 32 {
+		counterWrap = math.MaxUint32
+	}
+}
+
+// diskstats holds the counters of /proc/diskstats by device name.
+type diskstats map[string][]uint64
+
+// readDiskstats parses /proc/diskstats lines such as
+//
+//	8       0 sda 8803 2597 554494 3092 10449 8791 269880 7616 0 6196 10708
+//
+// Kernels since 4.18 append discard and flush counters, which are ignored.
+func readDiskstats(procfs *check.Procfs) (diskstats, error) {
+	data, err := procfs.ReadProc("diskstats")
+	if err != nil {
+		return nil, err
+	}
+	stats := make(diskstats)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3+diskstatsFields {
+			return nil, fmt.Errorf("unexpected diskstats line: %s", line)
+		}
+		counters := make([]uint64, diskstatsFields)
+		for i := range counters {
+			if counters[i], err = strconv.ParseUint(fields[3+i], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		stats[fields[2]] = counters
+	}
+	return stats, nil
+}
+
+// deviceIO is the activity of a device over an interval.
+type deviceIO struct {
+	name       string
+	usage      useType
+	readIOPS   float64
+	writeIOPS  float64
+	readBytes  float64
+	writeBytes float64
+	// await is the average time in ms an IO took, 0 without IO
+	await float64
+	util  float64
+	queue float64
+}
+
+// measureIO computes the activity of the devices present in both samples,
+// taken seconds apart, sorted by name.
+func measureIO(before, after diskstats, seconds float64) []*deviceIO {
+	var devices []*deviceIO
+	if seconds <= 0 {
+		return devices
+	}
+	for name, counters := range after {
+		previous, ok := before[name]
+		if !ok || len(previous) < diskstatsFields {
+			continue
+		}
+		delta := func(i int) float64 {
+			return float64(check.CounterDelta(previous[i], counters[i], counterWrap))
+		}
+		d := &deviceIO{
+			name:       name,
+			readIOPS:   delta(readsCompleted) / seconds,
+			writeIOPS:  delta(writesCompleted) / seconds,
+			readBytes:  delta(sectorsRead) * sectorSize / seconds,
+			writeBytes: delta(sectorsWritten) * sectorSize / seconds,
+			util:       math.Min(100, delta(msDoingIO)/(seconds*1000)*100),
+			queue:      delta(weightedMsDoingIO) / (seconds * 1000),
+		}
+		if ios := delta(readsCompleted) + delta(writesCompleted); ios > 0 {
+			d.await = (delta(msReading) + delta(msWriting)) / ios
+		}
+		devices = append(devices, d)
+	}
+	sort.Sort(byDeviceName(devices))
+	return devices
+}
+
+type byDeviceName []*deviceIO
+
+func (b byDeviceName) Len() int           { return len(b) }
+func (b byDeviceName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDeviceName) Less(i, j int) bool { return b[i].name < b[j].name }
+
+// deviceUseType classes a device by the mounts of itself and of its
+// partitions, with the rules of fillUseType.
+func deviceUseType(name string, mounts []*mount) useType {
+	device := &diskResult{filesystem: "/dev/" + name}
+	fillUseType(device)
+	for _, m := range mounts {
+		source := strings.TrimPrefix(m.source, "/dev/")
+		if source != name && !isPartitionOf(source, name) {
+			continue
+		}
+		mounted := &diskResult{filesystem: m.source, mounted: m.mountPoint}
+		fillUseType(mounted)
+		if mounted.usage != system {
+			return mounted.usage
+		}
+	}
+	return device.usage
+}
+
+// isPartitionOf reports whether partition, such as sda1 or nvme0n1p1, is a
+// partition of disk.
+func isPartitionOf(partition, disk string) bool {
+	if !strings.HasPrefix(partition, disk) || len(partition) == len(disk) {
+		return false
+	}
+	number := strings.TrimPrefix(partition[len(disk):], "p")
+	_, err := strconv.ParseUint(number, 10, 32)
+	return err == nil
+}
+
+// evaluate checks the activity of the devices against the levels.
+func (c *ioCheck) evaluate(devices []*deviceIO) *check.Status {
+	status := &check.Status{}
+	var problems bytes.Buffer
+	for _, d := range devices {
+		for _, level := range []struct {
+			name       string
+			value      float64
+			warn, crit *check.Range
+		}{
+			{"util", d.util, c.utilWarnLevel, c.utilCritLevel},
+			{"await", d.await, c.awaitWarnLevel, c.awaitCritLevel},
+			{"queue", d.queue, c.queueWarnLevel, c.queueCritLevel},
+		} {
+			state := check.Evaluate(level.value, level.warn, level.crit)
+			if state == nagios.NAGIOS_OK {
+				continue
+			}
+			fmt.Fprintf(&problems, "\n  %v device %v %s is %0.2f.", d.usage.string(), d.name, level.name, level.value)
+			if state > status.Value {
+				status.Value = state
+			}
+		}
+
+		labels := map[string]string{"device": d.name, "usage": d.usage.string()}
+		status.AddPerfdata(
+			check.NewPerfdata(d.name+" util", d.util, "%").Thresholds(c.utilWarnLevel, c.utilCritLevel).Bounds(0, 100).Metric("io_util", labels),
+			check.NewPerfdata(d.name+" await", d.await, "ms").Thresholds(c.awaitWarnLevel, c.awaitCritLevel).Minimum(0).Metric("io_await", labels),
+			check.NewPerfdata(d.name+" queue", d.queue, "").Thresholds(c.queueWarnLevel, c.queueCritLevel).Minimum(0).Metric("io_queue", labels),
+			check.NewPerfdata(d.name+" read iops", d.readIOPS, "").Minimum(0).Metric("io_ops", withDirection(labels, "read")),
+			check.NewPerfdata(d.name+" write iops", d.writeIOPS, "").Minimum(0).Metric("io_ops", withDirection(labels, "write")),
+			check.NewPerfdata(d.name+" read bytes", d.readBytes, "B").Minimum(0).Metric("io_bytes", withDirection(labels, "read")),
+			check.NewPerfdata(d.name+" write bytes", d.writeBytes, "B").Minimum(0).Metric("io_bytes", withDirection(labels, "write")),
+		)
+	}
+
+	status.Message = fmt.Sprintf("CheckDiskIO: %d devices.\n%s", len(devices), formatIO(devices))
+	if problems.Len() > 0 {
+		status.Message += "\nAlerts:" + problems.String()
+	}
+	return status
+}
+
+func withDirection(labels map[string]string, direction string) map[string]string {
+	with := map[string]string{"direction": direction}
+	for k, v := range labels {
+		with[k] = v
+	}
+	return with
+}
+
+// formatIO renders the devices as an iostat -x like table.
+func formatIO(devices []*deviceIO) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "   Device\tClass\tr/s\tw/s\trkB/s\twkB/s\tawait\taqu-sz\t%util")
+	for _, d := range devices {
+		fmt.Fprintf(w, "   %s\t%s\t%0.2f\t%0.2f\t%0.2f\t%0.2f\t%0.2f\t%0.2f\t%0.2f\n",
+			d.name, d.usage.string(), d.readIOPS, d.writeIOPS, d.readBytes/1024, d.writeBytes/1024, d.await, d.queue, d.util)
+	}
+	w.Flush()
+	return buf.String()
+}
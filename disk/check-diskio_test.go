@@ -0,0 +1,124 @@
+package disk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+func newIOCheck() *ioCheck {
+	return &ioCheck{
+		utilWarnLevel: check.MustParseRange("80"),
+		utilCritLevel: check.MustParseRange("95"),
+		excludeDevice: `^(loop|ram|zram|sr|fd)\d+$`,
+		procfs:        fixture,
+	}
+}
+
+func ioSamples(t *testing.T) []*deviceIO {
+	before, err := readDiskstats(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := readDiskstats(&check.Procfs{ProcRoot: "testdata/after/proc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return measureIO(before, after, 1)
+}
+
+func TestReadDiskstats(t *testing.T) {
+	stats, err := readDiskstats(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 7 || stats["loop0"][readsCompleted] != 52 || stats["xvda"][weightedMsDoingIO] != 80000 {
+		t.Errorf("unexpected diskstats %v.", stats)
+	}
+	if _, err := readDiskstats(&check.Procfs{ProcRoot: "testdata/missing"}); err == nil {
+		t.Error("a missing proc root should be an error.")
+	}
+}
+
+func TestMeasureIO(t *testing.T) {
+	devices := ioSamples(t)
+	if len(devices) != 7 || devices[2].name != "xvda" {
+		t.Fatalf("expected 7 devices sorted by name, got %d.", len(devices))
+	}
+	xvda := devices[2]
+	if xvda.readIOPS != 50 || xvda.writeIOPS != 150 || xvda.readBytes != 819200 || xvda.writeBytes != 614400 {
+		t.Errorf("unexpected xvda throughput %+v.", xvda)
+	}
+	if xvda.await != 1.5 || xvda.util != 10 || xvda.queue != 0.3 {
+		t.Errorf("expected await 1.5, util 10 and queue 0.3, got %+v.", xvda)
+	}
+	if xvdb := devices[4]; xvdb.await != 0 || xvdb.util != 0 {
+		t.Errorf("an idle device should have no await or util, got %+v.", xvdb)
+	}
+}
+
+func TestMeasureIOReset(t *testing.T) {
+	if counterWrap != 0 {
+		t.Skip("32 bit counters wrap around instead of being reset")
+	}
+	before := diskstats{"sdb": make([]uint64, diskstatsFields)}
+	after := diskstats{"sdb": make([]uint64, diskstatsFields)}
+	before["sdb"][readsCompleted], after["sdb"][readsCompleted] = 1000, 10
+	if devices := measureIO(before, after, 1); len(devices) != 1 || devices[0].readIOPS != 10 {
+		t.Errorf("a counter that went down should count from zero, got %+v.", devices)
+	}
+}
+
+func TestDeviceUseType(t *testing.T) {
+	mounts, _ := readMounts(fixture)
+	for name, expected := range map[string]useType{"xvda": system, "xvdd": osd, "xvdd1": osd, "rbd1": rbd, "xvd": system} {
+		if usage := deviceUseType(name, mounts); usage != expected {
+			t.Errorf("expected %s to be %s, got %s.", name, expected.string(), usage.string())
+		}
+	}
+	if !isPartitionOf("nvme0n1p1", "nvme0n1") || isPartitionOf("xvdaa", "xvda") {
+		t.Error("partitions should be told apart from other disks.")
+	}
+}
+
+func TestSelectDevices(t *testing.T) {
+	c := newIOCheck()
+	c.includeDevice = "^xvd[a-z]+$"
+	mounts, _ := readMounts(fixture)
+	devices, err := c.selectDevices(ioSamples(t), mounts)
+	if err != nil || len(devices) != 3 || devices[2].name != "xvdd" || devices[2].usage != osd {
+		t.Errorf("expected the 3 whole xvd disks, got %d devices, %v.", len(devices), err)
+	}
+	c.excludeDevice = "["
+	if _, err := c.selectDevices(nil, mounts); err == nil {
+		t.Error("invalid regex should be rejected.")
+	}
+}
+
+func TestEvaluateIO(t *testing.T) {
+	c := newIOCheck()
+	c.awaitWarnLevel = check.MustParseRange("4")
+	mounts, _ := readMounts(fixture)
+	devices, err := c.selectDevices(ioSamples(t), mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := c.evaluate(devices)
+	if status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("98%% util on the OSD disk should be CRITICAL, status is %v.", status)
+	}
+	for _, expected := range []string{
+		"CheckDiskIO: 6 devices.\n",
+		"  OSD device xvdd util is 98.00.",
+		"  RBD device rbd1 await is 5.00.",
+	} {
+		if !strings.Contains(status.Message, expected) {
+			t.Errorf("expected %q in %q.", expected, status.Message)
+		}
+	}
+	if len(status.Perfdata) != 6*7 || status.Perfdata[0].Labels["usage"] != "RBD" {
+		t.Errorf("unexpected perfdata %v.", check.FormatPerfdata(status.Perfdata))
+	}
+}
@@ -0,0 +1,153 @@
+package disk
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/alecthomas/units"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// levelRule overrides the capacity levels of the devices it matches.
+type levelRule struct {
+	name      string
+	match     func(device *diskResult) bool
+	warnLevel *check.Range
+	critLevel *check.Range
+}
+
+// parseMountRule parses a PATTERN=WARN,CRIT rule matching mount points by
+// regex, such as ^/var/lib/ceph/=75,85.
+func parseMountRule(spec string) (*levelRule, error) {
+	pattern, rule, err := parseRule(spec)
+	if err != nil {
+		return nil, err
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	rule.name = "mount " + pattern
+	rule.match = func(device *diskResult) bool {
+		return r.MatchString(device.mounted)
+	}
+	return rule, nil
+}
+
+// parseTypeRule parses a TYPE=WARN,CRIT rule matching a use type such as
+// OSD=75,85.
+func parseTypeRule(spec string) (*levelRule, error) {
+	name, rule, err := parseRule(spec)
+	if err != nil {
+		return nil, err
+	}
+	usage := toUseType(name)
+	if usage < 0 {
+		return nil, fmt.Errorf("unknown use type '%s', expected SYSTEM, OSD or RBD", name)
+	}
+	rule.name = "type " + usage.string()
+	rule.match = func(device *diskResult) bool {
+		return device.usage == usage
+	}
+	return rule, nil
+}
+
+func parseRule(spec string) (string, *levelRule, error) {
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 {
+		return "", nil, fmt.Errorf("expected MATCH=WARN,CRIT got '%s'", spec)
+	}
+	levels := strings.Split(spec[i+1:], ",")
+	if len(levels) != 2 {
+		return "", nil, fmt.Errorf("expected MATCH=WARN,CRIT got '%s'", spec)
+	}
+	warn, err := check.ParseRange(levels[0])
+	if err != nil {
+		return "", nil, err
+	}
+	crit, err := check.ParseRange(levels[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return spec[:i], &levelRule{warnLevel: warn, critLevel: crit}, nil
+}
+
+// applyRules gives every device the levels of the first rule matching it.
+func applyRules(devices []*diskResult, rules []*levelRule) {
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.match(device) {
+				device.rule = rule
+				break
+			}
+		}
+	}
+}
+
+// levels returns the capacity levels of the device, the given defaults
+// unless a rule matched it, scaled by its magic number factor.
+func (d *diskResult) levels(warning, critical *check.Range) (*check.Range, *check.Range) {
+	if d.rule != nil {
+		warning, critical = d.rule.warnLevel, d.rule.critLevel
+	}
+	if d.scale == 0 {
+		return warning, critical
+	}
+	return scaleLevel(warning, d.scale), scaleLevel(critical, d.scale)
+}
+
+func toUseType(name string) useType {
+	for _, usage := range []useType{system, osd, rbd} {
+		if strings.EqualFold(name, usage.string()) {
+			return usage
+		}
+	}
+	return -1
+}
+
+// freeLevel turns a minimum of free space into a range on the available
+// KB, unset for 0.
+func freeLevel(free units.Base2Bytes) (*check.Range, error) {
+	if free <= 0 {
+		return nil, nil
+	}
+	return check.ParseRange(fmt.Sprintf("%d:", int64(free)/1024))
+}
+
+// magicScale returns the factor by which the free space percentage of a
+// filesystem of size KB is scaled, following check_mk's df magic number:
+// filesystems larger than base get relaxed levels and smaller ones get
+// stricter levels, more so the smaller magic is. A magic of 0 or 1 leaves
+// the levels alone.
+func magicScale(size int64, magic float64, base units.Base2Bytes) float64 {
+	if magic <= 0 || magic == 1 || size <= 0 || base <= 0 {
+		return 1
+	}
+	relative := float64(size) * 1024 / float64(base)
+	return math.Pow(relative, magic) / relative
+}
+
+// scaleLevel scales the free space percentage left by an upper bound
+// capacity range such as 85 or ~:85. Other ranges are returned as is.
+func scaleLevel(r *check.Range, scale float64) *check.Range {
+	if scale == 1 || !r.IsSet() || r.Inside || r.Start > 0 || math.IsInf(r.End, 1) {
+		return r
+	}
+	end := 100 - (100-r.End)*scale
+	end = math.Max(0, math.Min(100, math.Floor(end*10+0.5)/10))
+	spec := strconv.FormatFloat(end, 'f', -1, 64)
+	if math.IsInf(r.Start, -1) {
+		spec = "~:" + spec
+	}
+	scaled, err := check.ParseRange(spec)
+	if err != nil {
+		return r
+	}
+	return scaled
+}
@@ -0,0 +1,339 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// errTimeout is returned for a mount that did not answer statfs in time,
+// typically a hung network filesystem.
+var errTimeout = errors.New("statfs timed out")
+
+// networkTypes are the filesystem types whose mounts may go stale when
+// their server goes away.
+var networkTypes = map[string]bool{
+	"nfs":            true,
+	"nfs4":           true,
+	"cifs":           true,
+	"smb3":           true,
+	"smbfs":          true,
+	"ceph":           true,
+	"glusterfs":      true,
+	"fuse.glusterfs": true,
+	"fuse.sshfs":     true,
+	"9p":             true,
+	"afs":            true,
+}
+
+// mount is a line of /proc/self/mountinfo.
+type mount struct {
+	mountPoint string
+	fsType     string
+	source     string
+	// device is the major:minor of the filesystem, shared by its bind
+	// mounts
+	device string
+	// options are the flags of the mount point and superOptions those of
+	// the filesystem, which /proc/mounts shows merged
+	options      []string
+	superOptions []string
+}
+
+func (m *mount) isNetwork() bool {
+	return networkTypes[m.fsType]
+}
+
+// readOnly reports whether the mount point or its filesystem is read-only.
+func (m *mount) readOnly() bool {
+	return hasOption(m.options, "ro") || hasOption(m.superOptions, "ro")
+}
+
+// remountedReadOnly reports whether the filesystem went read-only under a
+// read-write mount point, as ext4 does on errors with errors=remount-ro.
+func (m *mount) remountedReadOnly() bool {
+	return hasOption(m.options, "rw") && hasOption(m.superOptions, "ro")
+}
+
+func hasOption(options []string, name string) bool {
+	for _, option := range options {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readMounts(procfs *check.Procfs) ([]*mount, error) {
+	data, err := procfs.ReadProc("self", "mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	return parseMountinfo(data)
+}
+
+// parseMountinfo parses /proc/self/mountinfo lines such as
+//
+//	28 1 254:0 / / rw,relatime - ext4 /dev/vda rw
+//
+// A mount point mounted over keeps only its last mount.
+func parseMountinfo(data string) ([]*mount, error) {
+	var mounts []*mount
+	index := make(map[string]int)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || separator+2 >= len(fields) {
+			return nil, fmt.Errorf("unexpected mountinfo line: %s", line)
+		}
+		m := &mount{
+			mountPoint: unescapeMount(fields[4]),
+			fsType:     fields[separator+1],
+			source:     unescapeMount(fields[separator+2]),
+			device:     fields[2],
+			options:    strings.Split(fields[5], ","),
+		}
+		if separator+3 < len(fields) {
+			m.superOptions = strings.Split(fields[separator+3], ",")
+		}
+		if i, ok := index[m.mountPoint]; ok {
+			mounts[i] = m
+			continue
+		}
+		index[m.mountPoint] = len(mounts)
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// readFstab reads the filesystems of an fstab file that are mounted at boot.
+func readFstab(path string) ([]*mount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFstab(string(data))
+}
+
+// parseFstab parses fstab lines such as
+//
+//	UUID=0a1b2c3d /var/lib/ceph/osd/ceph-0 xfs noatime,inode64 0 0
+//
+// leaving out swap and noauto entries.
+func parseFstab(data string) ([]*mount, error) {
+	var mounts []*mount
+	for _, line := range strings.Split(data, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected fstab line: %s", line)
+		}
+		m := &mount{
+			mountPoint: path.Clean(unescapeMount(fields[1])),
+			fsType:     fields[2],
+			source:     unescapeMount(fields[0]),
+		}
+		if len(fields) > 3 {
+			m.options = strings.Split(fields[3], ",")
+		}
+		if m.fsType == "swap" || m.mountPoint == "none" || hasOption(m.options, "noauto") {
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// dedupe keeps a single mount of each filesystem, the one with the shortest
+// mount point, as df does for bind mounts. Mounts of unknown device are all
+// kept.
+func dedupe(mounts []*mount) []*mount {
+	var kept []*mount
+	index := make(map[string]int)
+	for _, m := range mounts {
+		if m.device == "" {
+			kept = append(kept, m)
+			continue
+		}
+		if i, ok := index[m.device]; ok {
+			if len(m.mountPoint) < len(kept[i].mountPoint) {
+				kept[i] = m
+			}
+			continue
+		}
+		index[m.device] = len(kept)
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+var escapedChar = regexp.MustCompile(`\\[0-7]{3}`)
+
+// unescapeMount decodes the octal escapes, such as \040 for a space, of
+// mountinfo paths.
+func unescapeMount(s string) string {
+	return escapedChar.ReplaceAllStringFunc(s, func(escaped string) string {
+		c, _ := strconv.ParseUint(escaped[1:], 8, 8)
+		return string([]byte{byte(c)})
+	})
+}
+
+// mountFilter selects the mounts to check with regular expressions on
+// their mount point, filesystem type and device. Empty expressions match
+// everything when including and nothing when excluding.
+type mountFilter struct {
+	includeMount  string
+	excludeMount  string
+	includeType   string
+	excludeType   string
+	includeDevice string
+	excludeDevice string
+}
+
+type compiledFilter struct {
+	include, exclude [3]*regexp.Regexp
+}
+
+func (f *mountFilter) compile() (*compiledFilter, error) {
+	c := &compiledFilter{}
+	for i, expr := range []string{f.includeMount, f.includeType, f.includeDevice, f.excludeMount, f.excludeType, f.excludeDevice} {
+		if expr == "" {
+			continue
+		}
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		if i < 3 {
+			c.include[i] = r
+		} else {
+			c.exclude[i-3] = r
+		}
+	}
+	return c, nil
+}
+
+func (c *compiledFilter) match(m *mount) bool {
+	values := []string{m.mountPoint, m.fsType, m.source}
+	for i, value := range values {
+		if c.include[i] != nil && !c.include[i].MatchString(value) {
+			return false
+		}
+		if c.exclude[i] != nil && c.exclude[i].MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// fsStats is the statfs of a mount, in bytes and inodes.
+type fsStats struct {
+	size      uint64
+	free      uint64
+	available uint64
+	inodes    uint64
+	freeNodes uint64
+}
+
+type statfsFunc func(path string) (*fsStats, error)
+
+func statfs(path string) (*fsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	blockSize := uint64(st.Frsize)
+	if blockSize == 0 {
+		blockSize = uint64(st.Bsize)
+	}
+	return &fsStats{
+		size:      st.Blocks * blockSize,
+		free:      st.Bfree * blockSize,
+		available: st.Bavail * blockSize,
+		inodes:    st.Files,
+		freeNodes: st.Ffree,
+	}, nil
+}
+
+// statfsTimeout runs statfs in its own goroutine so that a hung mount only
+// costs the timeout. The goroutine of a hung mount is left behind.
+func statfsTimeout(statfs statfsFunc, path string, timeout time.Duration) (*fsStats, error) {
+	type result struct {
+		stats *fsStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := statfs(path)
+		done <- result{stats, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.stats, r.err
+	case <-timer.C:
+		return nil, errTimeout
+	}
+}
+
+// isStale reports whether err means the mount went away under us.
+func isStale(err error) bool {
+	return err == errTimeout || err == syscall.ESTALE || err == syscall.EIO || err == syscall.ENOTCONN || err == syscall.EHOSTDOWN
+}
+
+// writeProbe creates, syncs and removes a file in dir, giving up after the
+// timeout. The goroutine of a hung filesystem is left behind.
+func writeProbe(dir string, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		file, err := ioutil.TempFile(dir, ".go_check_probe")
+		if err != nil {
+			done <- err
+			return
+		}
+		defer os.Remove(file.Name())
+		if _, err := file.WriteString("go_check write probe\n"); err != nil {
+			file.Close()
+			done <- err
+			return
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			done <- err
+			return
+		}
+		done <- file.Close()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errTimeout
+	}
+}
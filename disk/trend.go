@@ -0,0 +1,193 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// usageSample is the used KB of a mount at a unix time.
+type usageSample struct {
+	Time int64 `json:"t"`
+	Used int64 `json:"used"`
+}
+
+// usageHistory holds the recent samples of each mount point.
+type usageHistory map[string][]usageSample
+
+// record adds the usage of the devices at now and drops the samples older
+// than window.
+func (h usageHistory) record(devices []*diskResult, now time.Time, window time.Duration) {
+	oldest := now.Add(-window).Unix()
+	for mount, samples := range h {
+		var kept []usageSample
+		for _, sample := range samples {
+			if sample.Time >= oldest && sample.Time < now.Unix() {
+				kept = append(kept, sample)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h, mount)
+			continue
+		}
+		h[mount] = kept
+	}
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		h[device.mounted] = append(h[device.mounted], usageSample{Time: now.Unix(), Used: device.used})
+	}
+}
+
+// fitTrend returns the least squares slope of the used KB over time, in KB
+// per second, and false when the samples do not span any time.
+func fitTrend(samples []usageSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	n := float64(len(samples))
+	var sumT, sumU float64
+	for _, sample := range samples {
+		sumT += float64(sample.Time - samples[0].Time)
+		sumU += float64(sample.Used)
+	}
+	meanT, meanU := sumT/n, sumU/n
+	var covariance, variance float64
+	for _, sample := range samples {
+		dt := float64(sample.Time-samples[0].Time) - meanT
+		covariance += dt * (float64(sample.Used) - meanU)
+		variance += dt * dt
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return covariance / variance, true
+}
+
+// timeToFull returns when the device fills up at its growth rate, and false
+// if it is not growing or grows too slowly for the projection to fit in a
+// time.Duration, some 292 years.
+func (d *diskResult) timeToFull() (time.Duration, bool) {
+	if !d.hasTrend || d.growth <= 0 {
+		return 0, false
+	}
+	seconds := float64(d.available) / d.growth
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// trend records the usage of the devices in the state store and fits the
+// growth of each one over its history.
+func (c *diskCheck) trend(devices []*diskResult) error {
+	var history usageHistory
+	return c.state.Update(&history, func(found bool) error {
+		if !found || history == nil {
+			history = make(usageHistory)
+		}
+		history.record(devices, c.now(), c.trendWindow)
+		for _, device := range devices {
+			if device == nil {
+				continue
+			}
+			device.growth, device.hasTrend = fitTrend(history[device.mounted])
+		}
+		return nil
+	})
+}
+
+// durationLevel turns a minimum time to full into a range on seconds, unset
+// for 0.
+func durationLevel(d time.Duration) (*check.Range, error) {
+	if d <= 0 {
+		return nil, nil
+	}
+	return check.ParseRange(fmt.Sprintf("%d:", int64(d.Seconds())))
+}
+
+// summarizeFill checks the time to full of the growing devices against the
+// levels.
+func summarizeFill(devices []*diskResult, critical, warning *check.Range) (int, int, string) {
+	var problemMessages bytes.Buffer
+	critCount := 0
+	warnCount := 0
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		left, ok := device.timeToFull()
+		if !ok {
+			continue
+		}
+		switch check.Evaluate(left.Seconds(), warning, critical) {
+		case nagios.NAGIOS_CRITICAL:
+			fmt.Fprintln(&problemMessages, device.fillString())
+			critCount++
+		case nagios.NAGIOS_WARNING:
+			fmt.Fprintln(&problemMessages, device.fillString())
+			warnCount++
+		}
+	}
+	return critCount, warnCount, problemMessages.String()
+}
+
+// formatFill lists the estimated time to full of the growing devices.
+func formatFill(devices []*diskResult) string {
+	var estimates []string
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		if left, ok := device.timeToFull(); ok {
+			estimates = append(estimates, fmt.Sprintf("%s %s", device.mounted, formatDuration(left)))
+		}
+	}
+	if len(estimates) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("   Time to full: %s\n", strings.Join(estimates, ", "))
+}
+
+func trendPerfdata(devices []*diskResult, critical, warning *check.Range) []*check.Perfdata {
+	var metrics []*check.Perfdata
+	for _, device := range devices {
+		if device == nil {
+			continue
+		}
+		left, ok := device.timeToFull()
+		if !ok {
+			continue
+		}
+		labels := map[string]string{"mount": device.mounted, "device": device.filesystem, "usage": device.usage.string()}
+		metrics = append(metrics,
+			check.NewPerfdata(device.mounted+" time to full", float64(int64(left.Seconds())), "s").Thresholds(warning, critical).Minimum(0).Metric("time_to_full", labels),
+		)
+	}
+	return metrics
+}
+
+func (d *diskResult) fillString() string {
+	left, _ := d.timeToFull()
+	return fmt.Sprintf("  %v device %v will be full in %s, growing %s/h.", d.usage.string(), d.filesystem, formatDuration(left), formatKB(int64(d.growth*3600)))
+}
+
+// formatDuration renders a duration to the minute, such as 2d3h or 3h20m.
+func formatDuration(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	days, hours, minutes := minutes/(24*60), minutes/60%24, minutes%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -1,7 +1,6 @@
-package main
+package http
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -13,86 +12,117 @@ import (
 	"net/http"
 	"net/url"
 
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-var (
-	userAgent     = kingpin.Flag("user-agent", "Specify a USER-AGENT").Default("Go-HTTP-Check").String()
-	urlArg        = kingpin.Flag("url", "A URL to connect to").String()
-	host          = kingpin.Flag("host", "A HOSTNAME to connect to").String()
-	port          = kingpin.Flag("port", "Select another port").Int()
-	requestUri    = kingpin.Flag("request-uri", "Specify a uri path").String()
-	query         = kingpin.Flag("query", "request query (without ?)").String()
-	header        = kingpin.Flag("name", "Check for a HEADER").String()
-	ssl           = kingpin.Flag("ssl", "Enabling SSL connections").Default("false").Bool()
-	insecure      = kingpin.Flag("insecure", "Enabling insecure connections").Bool()
-	username      = kingpin.Flag("username", "A username to connect as").String()
-	password      = kingpin.Flag("password", "A password to use for the username").String()
-	certFile      = kingpin.Flag("cert-file", "Cert to use").String()
-	keyFile       = kingpin.Flag("key-file", "Key to use").String()
-	cacert        = kingpin.Flag("cacert", "A CA Cert to use").String()
-	expiry        = kingpin.Flag("expiry", "Warn EXPIRE days before cert expires").Int()
-	pattern       = kingpin.Flag("query", "Query for a specific pattern").String()
-	timeout       = kingpin.Flag("timeout", "Set the timeout").Default("15").Int()
-	redirectOk    = kingpin.Flag("redirect-ok", "Check if a redirect is ok").Bool()
-	redirectTo    = kingpin.Flag("redirect-to", "Redirect to another page").String()
-	responseBytes = kingpin.Flag("response-bytes", "Print BYTES of the output").Int()
-	requireBytes  = kingpin.Flag("require-bytes", "Check the response contains exactly BYTES bytes").Int()
-	responseCode  = kingpin.Flag("response-code", "Check for a specific response code").Int()
-)
+// Definition is the http subcommand.
+var Definition = &check.Definition{
+	Name:     "http",
+	Help:     "Check an HTTP(S) endpoint.",
+	Register: register,
+}
+
+type httpCheck struct {
+	userAgent     string
+	url           string
+	host          string
+	port          int
+	requestUri    string
+	query         string
+	header        string
+	ssl           bool
+	insecure      bool
+	username      string
+	password      string
+	certFile      string
+	keyFile       string
+	cacert        string
+	expiry        int
+	pattern       string
+	timeout       int
+	redirectOk    bool
+	redirectTo    string
+	responseBytes int
+	requireBytes  int
+	responseCode  int
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkHttp()
+func register(flags check.FlagSet) check.Check {
+	c := &httpCheck{}
+	flags.Flag("user-agent", "Specify a USER-AGENT").Default("Go-HTTP-Check").StringVar(&c.userAgent)
+	flags.Flag("url", "A URL to connect to").StringVar(&c.url)
+	flags.Flag("host", "A HOSTNAME to connect to").StringVar(&c.host)
+	flags.Flag("port", "Select another port").IntVar(&c.port)
+	flags.Flag("request-uri", "Specify a uri path").StringVar(&c.requestUri)
+	flags.Flag("query", "request query (without ?)").StringVar(&c.query)
+	flags.Flag("name", "Check for a HEADER").StringVar(&c.header)
+	flags.Flag("ssl", "Enabling SSL connections").Default("false").BoolVar(&c.ssl)
+	flags.Flag("insecure", "Enabling insecure connections").BoolVar(&c.insecure)
+	flags.Flag("username", "A username to connect as").StringVar(&c.username)
+	flags.Flag("password", "A password to use for the username").StringVar(&c.password)
+	flags.Flag("cert-file", "Cert to use").StringVar(&c.certFile)
+	flags.Flag("key-file", "Key to use").StringVar(&c.keyFile)
+	flags.Flag("cacert", "A CA Cert to use").StringVar(&c.cacert)
+	flags.Flag("expiry", "Warn EXPIRE days before cert expires").IntVar(&c.expiry)
+	flags.Flag("query", "Query for a specific pattern").StringVar(&c.pattern)
+	flags.Flag("timeout", "Set the timeout").Default("15").IntVar(&c.timeout)
+	flags.Flag("redirect-ok", "Check if a redirect is ok").BoolVar(&c.redirectOk)
+	flags.Flag("redirect-to", "Redirect to another page").StringVar(&c.redirectTo)
+	flags.Flag("response-bytes", "Print BYTES of the output").IntVar(&c.responseBytes)
+	flags.Flag("require-bytes", "Check the response contains exactly BYTES bytes").IntVar(&c.requireBytes)
+	flags.Flag("response-code", "Check for a specific response code").IntVar(&c.responseCode)
+	return c
 }
 
-func checkHttp() {
+func (c *httpCheck) Run() *check.Status {
+	requestUrl, err := c.createUrl()
+	if err != nil {
+		return check.Unknown(err)
+	}
 
 	request := &http.Request{
 		Method: "GET",
-		URL:    createUrl(),
+		URL:    requestUrl,
 		Close:  true,
 	}
 
 	var config *tls.Config
-	requestTimeout := (time.Duration(*timeout) * time.Second)
-	if *ssl {
+	requestTimeout := (time.Duration(c.timeout) * time.Second)
+	if c.ssl {
 
 		certificates := make([]tls.Certificate, 1)
-		if *certFile != "" {
-			certificates[0], _ = tls.LoadX509KeyPair(*certFile, *keyFile)
+		if c.certFile != "" {
+			certificates[0], _ = tls.LoadX509KeyPair(c.certFile, c.keyFile)
 		}
 
 		var clientCAs *x509.CertPool
-		if *cacert != "" {
+		if c.cacert != "" {
 			clientCAs := x509.NewCertPool()
-			data, err := ioutil.ReadFile(*cacert)
+			data, err := ioutil.ReadFile(c.cacert)
 			if err != nil {
-				nagios.Unknown(err.Error())
+				return check.Unknown(err)
 			}
 			clientCAs.AppendCertsFromPEM(data)
 		}
 
-		if *expiry > 0 {
+		if c.expiry > 0 {
 			certExpiry := certificates[0].Leaf.NotAfter
 			daysDifference := int(certExpiry.Sub(time.Now()).Hours() / 24)
-			if daysDifference <= *expiry {
-				nagios.Warning(fmt.Sprintf("Certificate will expire %v", certExpiry))
+			if daysDifference <= c.expiry {
+				return check.Warning(fmt.Sprintf("Certificate will expire %v", certExpiry))
 			}
 		}
 
 		config = &tls.Config{
-			InsecureSkipVerify: *insecure,
+			InsecureSkipVerify: c.insecure,
 			Certificates:       certificates,
 			RootCAs:            clientCAs,
 		}
 
 	}
 
-	if *username != "" && *password != "" {
-		request.SetBasicAuth(*username, *password)
+	if c.username != "" && c.password != "" {
+		request.SetBasicAuth(c.username, c.password)
 	}
 
 	transport := &http.Transport{
@@ -106,108 +136,113 @@ func checkHttp() {
 	}
 
 	request.Header = http.Header{}
-	if *userAgent != "" {
-		request.Header.Set("User-Agent", *userAgent)
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
 	}
-	if *header != "" {
-		headers := strings.Split(*header, ",")
+	if c.header != "" {
+		headers := strings.Split(c.header, ",")
 		for _, h := range headers {
 			kv := strings.Split(h, ":")
 			request.Header.Set(kv[0], kv[1])
 		}
 	}
 
+	start := time.Now()
 	response, err := client.Do(request)
 	if err != nil {
-		nagios.Critical(err)
+		return check.Critical(err.Error())
 	}
 	defer response.Body.Close()
+	firstByte := time.Since(start)
 
 	code := response.StatusCode
 
 	var body string
-	if *responseBytes > 0 {
-		b := make([]byte, *responseBytes)
+	if c.responseBytes > 0 {
+		b := make([]byte, c.responseBytes)
 		if n, err := request.Body.Read(b); n == 0 || err != nil {
-			nagios.Critical(err)
+			return check.Critical(err.Error())
 		}
 		body = "\n" + string(b)
 	}
 
 	b, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
 	}
 	fullBody := string(b)
 	size := len(b)
+	elapsed := time.Since(start)
 
-	if *requireBytes > 0 {
-		if size != *requireBytes {
-			err := errors.New(fmt.Sprintf("Response was %d bytes instead of %d%s", size, *requireBytes, body))
-			nagios.Critical(err)
+	status := c.evaluate(response, code, size, fullBody, body)
+	status.AddPerfdata(
+		check.NewPerfdata("time", elapsed.Seconds(), "s").Bounds(0, requestTimeout.Seconds()),
+		check.NewPerfdata("time_firstbyte", firstByte.Seconds(), "s").Bounds(0, requestTimeout.Seconds()),
+		check.NewPerfdata("size", float64(size), "B").Minimum(0),
+	)
+	return status
+}
+
+func (c *httpCheck) evaluate(response *http.Response, code, size int, fullBody, body string) *check.Status {
+	if c.requireBytes > 0 {
+		if size != c.requireBytes {
+			return check.Critical(fmt.Sprintf("Response was %d bytes instead of %d%s", size, c.requireBytes, body))
 		}
 	}
 
 	switch {
 	case code/200 == 1:
-		if *redirectTo != "" {
-			err := errors.New(fmt.Sprintf("Expected redirect to %s but got %d%s", *redirectTo, code, body))
-			nagios.Critical(err)
-		} else if *pattern != "" {
-			r, err := regexp.Compile(*pattern)
+		if c.redirectTo != "" {
+			return check.Critical(fmt.Sprintf("Expected redirect to %s but got %d%s", c.redirectTo, code, body))
+		} else if c.pattern != "" {
+			r, err := regexp.Compile(c.pattern)
 			if err != nil {
-				nagios.Unknown(err.Error())
+				return check.Unknown(err)
 			}
 			if r.MatchString(fullBody) {
-				nagios.Ok(fmt.Sprintf("%d, found /%s/ in %d bytes%s", code, *pattern, size, body))
+				return check.Ok(fmt.Sprintf("%d, found /%s/ in %d bytes%s", code, c.pattern, size, body))
 			} else {
-				err := errors.New(fmt.Sprintf("%d, did not found /%s/ in %d bytes%s", code, *pattern, size, body))
-				nagios.Critical(err)
+				return check.Critical(fmt.Sprintf("%d, did not found /%s/ in %d bytes%s", code, c.pattern, size, body))
 			}
 		} else {
-			nagios.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
+			return check.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
 		}
 	case code/300 == 1:
-		if *redirectOk || *redirectTo != "" {
-			if *redirectOk {
-				nagios.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
+		if c.redirectOk || c.redirectTo != "" {
+			if c.redirectOk {
+				return check.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
 			} else {
-				err := errors.New(fmt.Sprintf("Expected redirect to %s instead redirected to %s", *redirectTo, response.Request.URL.String()))
-				nagios.Critical(err)
+				return check.Critical(fmt.Sprintf("Expected redirect to %s instead redirected to %s", c.redirectTo, response.Request.URL.String()))
 			}
 		} else {
-			nagios.Warning(fmt.Sprintf("%d %s", code, body))
+			return check.Warning(fmt.Sprintf("%d %s", code, body))
 		}
 	case code/400 == 1, code/500 == 1:
-		if *responseCode == code {
-			nagios.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
+		if c.responseCode == code {
+			return check.Ok(fmt.Sprintf("%d, %d bytes%s", code, size, body))
 		} else {
-			err := errors.New(fmt.Sprintf("%d%s", code, body))
-			nagios.Critical(err)
+			return check.Critical(fmt.Sprintf("%d%s", code, body))
 		}
 	}
+	return check.Unknownf("Unexpected response code %d%s", code, body)
 }
 
-func createUrl() *url.URL {
-	if *urlArg != "" {
-		if u, err := url.Parse(*urlArg); err != nil {
-			nagios.Unknown(err.Error())
-		} else {
-			return u
-		}
+func (c *httpCheck) createUrl() (*url.URL, error) {
+	if c.url != "" {
+		return url.Parse(c.url)
 	}
 
 	scheme := "http"
-	if *ssl {
+	if c.ssl {
 		scheme += "s"
 	}
 	hostname := ""
-	if *host != "" {
-		hostname = *host
+	if c.host != "" {
+		hostname = c.host
 	}
-	if *port > 0 {
-		hostname += fmt.Sprintf(":%d", *port)
-	} else if *ssl {
+	if c.port > 0 {
+		hostname += fmt.Sprintf(":%d", c.port)
+	} else if c.ssl {
 		hostname += ":443"
 	} else {
 		hostname += ":80"
@@ -216,7 +251,7 @@ func createUrl() *url.URL {
 	return &url.URL{
 		Scheme:   scheme,
 		Host:     hostname,
-		Path:     *requestUri,
-		RawQuery: *query,
-	}
+		Path:     c.requestUri,
+		RawQuery: c.query,
+	}, nil
 }
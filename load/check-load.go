@@ -1,79 +1,160 @@
-package main
+package load
 
 import (
 	"fmt"
 	"strconv"
 	"strings"
 
-	"io/ioutil"
-
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
 type load struct {
-	one     float32
-	five    float32
-	fifteen float32
+	one     float64
+	five    float64
+	fifteen float64
 }
 
-var (
-	warnLevel = kingpin.Flag("warn-level", "warn level").Default("10,20,30").String()
-	critLevel = kingpin.Flag("crit-level", "crit level").Default("15,50,75").String()
-)
+// Definition is the load subcommand.
+var Definition = &check.Definition{
+	Name:     "load",
+	Help:     "Check the 1, 5 and 15 minute load averages.",
+	Register: register,
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkLoad(*warnLevel, *critLevel)
+type loadCheck struct {
+	warnLevel loadRanges
+	critLevel loadRanges
+	perCore   bool
+	procfs    *check.Procfs
 }
 
-func checkLoad(warnLevel, critLevel string) {
-	warnLoad := toLoad(warnLevel)
-	critLoad := toLoad(critLevel)
+func register(flags check.FlagSet) check.Check {
+	c := &loadCheck{}
+	flags.Flag("warn-level", "warn range for all load averages, or comma separated ranges for the 1, 5 and 15 minute averages where an empty one is skipped").Default("10,20,30").SetValue(&c.warnLevel)
+	flags.Flag("crit-level", "crit range for all load averages, or comma separated ranges for the 1, 5 and 15 minute averages where an empty one is skipped").Default("15,50,75").SetValue(&c.critLevel)
+	flags.Flag("per-core", "Divide the load averages by the number of online cpus before comparing them").BoolVar(&c.perCore)
+	c.procfs = check.ProcfsFlags(flags)
+	return c
+}
 
-	data, err := ioutil.ReadFile("/proc/loadavg")
+func (c *loadCheck) Run() *check.Status {
+	warnLoad, critLoad := c.warnLevel[:], c.critLevel[:]
+
+	loadavgData, err := c.procfs.ReadProc("loadavg")
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
 	}
-	loadavgData := string(data)
-	rawData := strings.Join(strings.Fields(loadavgData)[0:3], ",")
-	load := toLoad(rawData)
-
-	isCrit := threshold(load, critLoad)
-	isWarn := threshold(load, warnLoad)
-
-	status := &nagios.NagiosStatus{}
-	switch {
-	case isCrit:
-		status.Value = nagios.NAGIOS_CRITICAL
-	case isWarn:
-		status.Value = nagios.NAGIOS_WARNING
-	default:
-		status.Value = nagios.NAGIOS_OK
+	avg, err := toLoad(loadavgData)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	// the cpu count is only read to normalize the load in per core mode,
+	// where the thresholds apply to the normalized load
+	var cpus int
+	var normalized *load
+	rawWarn, rawCrit := warnLoad, critLoad
+	evaluated := avg
+	if c.perCore {
+		if cpus, err = c.procfs.OnlineCPUs(); err != nil {
+			return check.Unknown(err)
+		}
+		normalized = &load{
+			one:     avg.one / float64(cpus),
+			five:    avg.five / float64(cpus),
+			fifteen: avg.fifteen / float64(cpus),
+		}
+		rawWarn, rawCrit = make([]*check.Range, 3), make([]*check.Range, 3)
+		evaluated = normalized
+	}
+
+	status := &check.Status{}
+	for i, value := range evaluated.values() {
+		if state := check.Evaluate(value, warnLoad[i], critLoad[i]); state > status.Value {
+			status.Value = state
+		}
 	}
 
-	status.Message = fmt.Sprintf("CheckLoad: %0.2f, %0.2f, %0.2f", load.one, load.five, load.fifteen)
-	nagios.ExitWithStatus(status)
+	status.Message = fmt.Sprintf("CheckLoad: %0.2f, %0.2f, %0.2f", avg.one, avg.five, avg.fifteen)
+	if c.perCore {
+		status.Message += fmt.Sprintf(" (%0.2f, %0.2f, %0.2f per core, %d cpus)", normalized.one, normalized.five, normalized.fifteen, cpus)
+	}
+	status.AddPerfdata(
+		check.NewPerfdata("load1", avg.one, "").Thresholds(rawWarn[0], rawCrit[0]).Minimum(0),
+		check.NewPerfdata("load5", avg.five, "").Thresholds(rawWarn[1], rawCrit[1]).Minimum(0),
+		check.NewPerfdata("load15", avg.fifteen, "").Thresholds(rawWarn[2], rawCrit[2]).Minimum(0),
+	)
+	if c.perCore {
+		status.AddPerfdata(
+			check.NewPerfdata("load1_per_core", normalized.one, "").Thresholds(warnLoad[0], critLoad[0]).Minimum(0),
+			check.NewPerfdata("load5_per_core", normalized.five, "").Thresholds(warnLoad[1], critLoad[1]).Minimum(0),
+			check.NewPerfdata("load15_per_core", normalized.fifteen, "").Thresholds(warnLoad[2], critLoad[2]).Minimum(0),
+			check.NewPerfdata("cpus", float64(cpus), "").Minimum(0),
+		)
+	}
+	return status
 }
 
-func toLoad(data string) *load {
-	arr := strings.Split(data, ",")
-	return &load{
-		one:     toFloat(arr[0]),
-		five:    toFloat(arr[1]),
-		fifteen: toFloat(arr[2]),
+// toLoad parses the averages of /proc/loadavg, such as
+// "0.42 1.05 2.50 1/123 4567".
+func toLoad(data string) (*load, error) {
+	arr := strings.Fields(data)
+	if len(arr) < 3 {
+		return nil, fmt.Errorf("unexpected loadavg '%s'", strings.TrimSpace(data))
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		var err error
+		if values[i], err = toFloat(arr[i]); err != nil {
+			return nil, err
+		}
 	}
+	return &load{one: values[0], five: values[1], fifteen: values[2]}, nil
 }
 
-func toFloat(str string) float32 {
-	f, _ := strconv.ParseFloat(str, 32)
-	return float32(f)
+func toFloat(str string) (float64, error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid load average '%s'", str)
+	}
+	return f, nil
+}
+
+var averages = []string{"1", "5", "15"}
+
+// loadRanges are the ranges of the 1, 5 and 15 minute averages. A single
+// range applies to all three and an empty one is skipped, so "10",
+// "10,20,30" and ",,30" are all valid. It implements kingpin.Value.
+type loadRanges [3]*check.Range
+
+func (r *loadRanges) Set(spec string) error {
+	arr := strings.Split(spec, ",")
+	switch len(arr) {
+	case 1:
+		arr = []string{arr[0], arr[0], arr[0]}
+	case 3:
+	default:
+		return fmt.Errorf("expected one range or three comma separated ranges, got '%s'", spec)
+	}
+	var ranges loadRanges
+	for i := range ranges {
+		parsed, err := check.ParseRange(arr[i])
+		if err != nil {
+			return fmt.Errorf("%s minute average: %s", averages[i], err)
+		}
+		ranges[i] = parsed
+	}
+	*r = ranges
+	return nil
+}
+
+func (r *loadRanges) String() string {
+	specs := make([]string, len(r))
+	for i, parsed := range r {
+		specs[i] = parsed.String()
+	}
+	return strings.Join(specs, ",")
 }
 
-func threshold(actualLoad, compareLoad *load) bool {
-	oneOverThreshold := actualLoad.one >= compareLoad.one
-	fiveOverThreshold := actualLoad.five >= compareLoad.five
-	fifteenOverThreshold := actualLoad.fifteen >= compareLoad.fifteen
-	return oneOverThreshold || fiveOverThreshold || fifteenOverThreshold
+func (l *load) values() []float64 {
+	return []float64{l.one, l.five, l.fifteen}
 }
@@ -0,0 +1,102 @@
+package load
+
+import (
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+var fixture = &check.Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/sys"}
+
+func ranges(spec string) loadRanges {
+	var r loadRanges
+	if err := r.Set(spec); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestRun(t *testing.T) {
+	c := &loadCheck{warnLevel: ranges("1,1,1"), critLevel: ranges("2,2,2"), procfs: fixture}
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("expected CRITICAL, status is %v.", status)
+	}
+	expected := "CRITICAL: CheckLoad: 0.42, 1.05, 2.50 | load1=0.42;1;2;0 load5=1.05;1;2;0 load15=2.5;1;2;0"
+	if status.String() != expected {
+		t.Errorf("expected %q, output is %q.", expected, status.String())
+	}
+}
+
+func TestRunPerCore(t *testing.T) {
+	c := &loadCheck{warnLevel: ranges("0.5,0.5,0.5"), critLevel: ranges("1,1,1"), perCore: true, procfs: fixture}
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("expected WARNING, status is %v.", status)
+	}
+	expected := "WARNING: CheckLoad: 0.42, 1.05, 2.50 (0.10, 0.26, 0.62 per core, 4 cpus) | load1=0.42;;;0 load5=1.05;;;0 load15=2.5;;;0 " +
+		"load1_per_core=0.105;0.5;1;0 load5_per_core=0.2625;0.5;1;0 load15_per_core=0.625;0.5;1;0 cpus=4;;;0"
+	if status.String() != expected {
+		t.Errorf("expected %q, output is %q.", expected, status.String())
+	}
+}
+
+func TestRunMissingProcRoot(t *testing.T) {
+	c := &loadCheck{warnLevel: ranges("1,5,10"), critLevel: ranges("2,10,20"), procfs: &check.Procfs{ProcRoot: "testdata/missing"}}
+	if status := c.Run(); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("expected UNKNOWN, status is %v.", status)
+	}
+}
+
+func TestRunWithoutCPUCount(t *testing.T) {
+	procfs := &check.Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/missing"}
+	c := &loadCheck{warnLevel: ranges("1,1,1"), critLevel: ranges("2,2,2"), procfs: procfs}
+	status := c.Run()
+	expected := "CRITICAL: CheckLoad: 0.42, 1.05, 2.50 | load1=0.42;1;2;0 load5=1.05;1;2;0 load15=2.5;1;2;0"
+	if status.String() != expected {
+		t.Errorf("the cpu count should not be needed without --per-core, output is %q.", status.String())
+	}
+
+	c.perCore = true
+	if status := c.Run(); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("per core mode needs the cpu count, status is %v.", status)
+	}
+}
+
+func TestLoadRanges(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"10,20,30":  "10,20,30",
+		"4":         "4,4,4",
+		",,30":      ",,30",
+		"@1:2,~:5,": "@1:2,~:5,",
+		"":          ",,",
+	} {
+		var r loadRanges
+		if err := r.Set(spec); err != nil {
+			t.Errorf("ranges %q should be valid: %s", spec, err)
+		} else if r.String() != expected {
+			t.Errorf("expected ranges %q to be %q, got %q.", spec, expected, r.String())
+		}
+	}
+	for _, spec := range []string{"1,2", "1,2,3,4", "1,x,3", "5:1"} {
+		var r loadRanges
+		if err := r.Set(spec); err == nil {
+			t.Errorf("ranges %q should be invalid.", spec)
+		}
+	}
+}
+
+func TestParseRejectsInvalidLevels(t *testing.T) {
+	if _, err := Definition.Parse([]string{"--warn-level=5", "--crit-level=1,2"}); err == nil {
+		t.Error("two crit levels should be rejected.")
+	}
+}
+
+func TestToLoad(t *testing.T) {
+	for _, data := range []string{"", "0.42 1.05", "0.42 x 2.50 1/123 4567"} {
+		if _, err := toLoad(data); err == nil {
+			t.Errorf("loadavg %q should be invalid.", data)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/agent"
+	"github.com/AcalephStorage/go_check/ceph"
+	"github.com/AcalephStorage/go_check/check"
+	"github.com/AcalephStorage/go_check/config"
+	"github.com/AcalephStorage/go_check/cpu"
+	"github.com/AcalephStorage/go_check/disk"
+	httpcheck "github.com/AcalephStorage/go_check/http"
+	"github.com/AcalephStorage/go_check/load"
+	"github.com/AcalephStorage/go_check/mem"
+	"github.com/AcalephStorage/go_check/ntp"
+	"github.com/AcalephStorage/go_check/proc"
+)
+
+const version = "1.0.0"
+
+var definitions = []*check.Definition{
+	ceph.Definition,
+	cpu.Definition,
+	disk.Definition,
+	disk.IODefinition,
+	httpcheck.Definition,
+	load.Definition,
+	mem.Definition,
+	ntp.Definition,
+	proc.Definition,
+}
+
+func main() {
+	// check-cpu, check-disk, ... symlinks run the check directly
+	name := filepath.Base(os.Args[0])
+	if strings.HasPrefix(name, "check-") {
+		if def := check.FindDefinition(definitions, strings.TrimPrefix(name, "check-")); def != nil {
+			runSingle(name, def)
+		}
+	}
+	runMulti()
+}
+
+func runSingle(name string, def *check.Definition) {
+	app := kingpin.New(name, def.Help)
+	app.Version(version)
+	c := def.Register(app)
+	output := check.OutputFlags(app)
+	if _, err := app.Parse(os.Args[1:]); err != nil {
+		check.ExitWithStatus(check.Unknown(err))
+	}
+	output.Exit(def.Name, c.Run())
+}
+
+func runMulti() {
+	app := kingpin.New("go_check", "Nagios compatible checks in Go")
+	app.Version(version)
+	checks := make(map[string]check.Check)
+	outputs := make(map[string]*check.Output)
+	for _, def := range definitions {
+		cmd := app.Command(def.Name, def.Help)
+		checks[def.Name] = def.Register(cmd)
+		outputs[def.Name] = check.OutputFlags(cmd)
+	}
+
+	agentCmd := app.Command("agent", "Run checks on a schedule and serve their latest results over HTTP.")
+	listen := agentCmd.Flag("listen", "Address to serve results on").Default("127.0.0.1:9399").String()
+	jobSpecs := agentCmd.Flag("check", "Check to schedule, as NAME=INTERVAL COMMAND [ARGS...]").Strings()
+	agentConfig := agentCmd.Flag("config", "YAML or JSON file of checks to schedule").String()
+
+	runCmd := app.Command("run", "Run every check of a config file once and report the aggregated result.")
+	runConfig := runCmd.Flag("config", "YAML or JSON file of checks to run").Required().String()
+	runOutput := check.OutputFlags(runCmd)
+
+	command, err := app.Parse(os.Args[1:])
+	if err != nil {
+		check.ExitWithStatus(check.Unknown(err))
+	}
+	switch command {
+	case "agent":
+		runAgent(app, *listen, *agentConfig, *jobSpecs)
+		return
+	case "run":
+		runConfigFile(*runConfig, runOutput)
+		return
+	}
+	c, ok := checks[command]
+	if !ok {
+		app.Usage(os.Stderr)
+		os.Exit(int(nagios.NAGIOS_UNKNOWN))
+	}
+	outputs[command].Exit(command, c.Run())
+}
+
+func runConfigFile(path string, output *check.Output) {
+	jobs, err := loadJobs(path)
+	if err != nil {
+		check.ExitWithStatus(check.Unknown(err))
+	}
+	output.Exit("run", agent.Aggregate(agent.RunAll(jobs)))
+}
+
+func runAgent(app *kingpin.Application, listen, configFile string, specs []string) {
+	var jobs []*agent.Job
+	if configFile != "" {
+		var err error
+		jobs, err = loadJobs(configFile)
+		app.FatalIfError(os.Stderr, err, "")
+	}
+	for _, spec := range specs {
+		job, err := agent.ParseJob(definitions, spec)
+		app.FatalIfError(os.Stderr, err, "")
+		jobs = append(jobs, job)
+	}
+	a, err := agent.New(jobs)
+	app.FatalIfError(os.Stderr, err, "")
+
+	a.Start()
+	app.FatalIfError(os.Stderr, http.ListenAndServe(listen, a), "")
+}
+
+func loadJobs(path string) ([]*agent.Job, error) {
+	c, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Jobs(definitions)
+}
@@ -1,63 +1,208 @@
-package main
+package mem
 
 import (
-	"bytes"
 	"fmt"
 	"strconv"
 	"strings"
-
-	"os/exec"
+	"time"
 
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-var (
-	warnLevel = kingpin.Flag("warn-level", "warn level").Default("30").Int()
-	critLevel = kingpin.Flag("crit-level", "crit level").Default("15").Int()
-)
+// Definition is the mem subcommand.
+var Definition = &check.Definition{
+	Name:     "mem",
+	Help:     "Check available memory.",
+	Register: register,
+}
+
+type memCheck struct {
+	warnLevel     *check.Range
+	critLevel     *check.Range
+	swapWarnLevel *check.Range
+	swapCritLevel *check.Range
+	rateWarnLevel *check.Range
+	rateCritLevel *check.Range
+	interval      time.Duration
+	procfs        *check.Procfs
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkMem(*warnLevel, *critLevel)
+func register(flags check.FlagSet) check.Check {
+	c := &memCheck{
+		warnLevel:     check.LowRangeFlag(flags.Flag("warn-level", "warn range for available memory percentage, a bare N alerts below N like N:").Default("30")),
+		critLevel:     check.LowRangeFlag(flags.Flag("crit-level", "crit range for available memory percentage, a bare N alerts below N like N:").Default("15")),
+		swapWarnLevel: check.RangeFlag(flags.Flag("swap-warn-level", "warn range for used swap percentage")),
+		swapCritLevel: check.RangeFlag(flags.Flag("swap-crit-level", "crit range for used swap percentage")),
+		rateWarnLevel: check.RangeFlag(flags.Flag("swap-rate-warn-level", "warn range for pages swapped in or out per second")),
+		rateCritLevel: check.RangeFlag(flags.Flag("swap-rate-crit-level", "crit range for pages swapped in or out per second")),
+		procfs:        check.ProcfsFlags(flags),
+	}
+	flags.Flag("interval", "time to sample the swap rate over when a swap rate level is set, 0 to skip it").Default("1s").DurationVar(&c.interval)
+	return c
 }
 
-func checkMem(warnLevel, critLevel int) {
-	cmd := exec.Command("free", "-m")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+func (c *memCheck) Run() *check.Status {
+	// sampling the swap rate takes an interval, so it is left out unless
+	// there is a level to check it against
+	sampled := c.interval > 0 && (c.rateWarnLevel.IsSet() || c.rateCritLevel.IsSet())
+	var swapIn, swapOut float64
+	if sampled {
+		var err error
+		if swapIn, swapOut, err = c.swapRate(); err != nil {
+			return check.Unknown(err)
+		}
+	}
+
+	data, err := c.procfs.ReadProc("meminfo")
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
+	}
+	info, err := parseMeminfo(data)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	if info["MemTotal"] == 0 {
+		return check.Unknownf("no MemTotal in %s", c.procfs.Proc("meminfo"))
+	}
+
+	total := toMB(info["MemTotal"])
+	available := toMB(info.available())
+	availablePercentage := int(float64(info.available()) / float64(info["MemTotal"]) * float64(100))
+	swapTotal := toMB(info["SwapTotal"])
+	swapUsed := toMB(info["SwapTotal"] - info["SwapFree"])
+	swapPercentage := 0
+	if info["SwapTotal"] > 0 {
+		swapPercentage = int(float64(info["SwapTotal"]-info["SwapFree"]) / float64(info["SwapTotal"]) * float64(100))
+	}
+
+	status := &check.Status{}
+	for _, state := range []nagios.NagiosStatusVal{
+		check.Evaluate(float64(availablePercentage), c.warnLevel, c.critLevel),
+		check.Evaluate(float64(swapPercentage), c.swapWarnLevel, c.swapCritLevel),
+		check.Evaluate(swapIn, c.rateWarnLevel, c.rateCritLevel),
+		check.Evaluate(swapOut, c.rateWarnLevel, c.rateCritLevel),
+	} {
+		if state > status.Value {
+			status.Value = state
+		}
+	}
+
+	status.Message = fmt.Sprintf("Check Mem: total=%vmB available=%vmB, %v%% Available Memory left.\n", total, available, availablePercentage)
+	status.Message += fmt.Sprintf("buffers=%vmB cached=%vmB slab=%vmB dirty=%vmB hugepages=%v/%v\n",
+		toMB(info["Buffers"]), toMB(info["Cached"]), toMB(info["Slab"]), toMB(info["Dirty"]),
+		info["HugePages_Free"], info["HugePages_Total"])
+	status.Message += fmt.Sprintf("swap=%v/%vmB, %v%% used", swapUsed, swapTotal, swapPercentage)
+	if sampled {
+		status.Message += fmt.Sprintf(", %0.2f pages/s in, %0.2f pages/s out", swapIn, swapOut)
 	}
-	result := out.String()
+	status.AddPerfdata(
+		check.NewPerfdata("available_pct", float64(availablePercentage), "%").Thresholds(c.warnLevel, c.critLevel).Bounds(0, 100).Metric("available", nil),
+		check.NewPerfdata("available", float64(available), "MB").Bounds(0, float64(total)),
+		check.NewPerfdata("total", float64(total), "MB").Minimum(0),
+		check.NewPerfdata("buffers", float64(toMB(info["Buffers"])), "MB").Bounds(0, float64(total)),
+		check.NewPerfdata("cached", float64(toMB(info["Cached"])), "MB").Bounds(0, float64(total)),
+		check.NewPerfdata("slab", float64(toMB(info["Slab"])), "MB").Bounds(0, float64(total)),
+		check.NewPerfdata("dirty", float64(toMB(info["Dirty"])), "MB").Bounds(0, float64(total)),
+		check.NewPerfdata("swap_used", float64(swapUsed), "MB").Bounds(0, float64(swapTotal)),
+		check.NewPerfdata("swap_total", float64(swapTotal), "MB").Minimum(0),
+		check.NewPerfdata("swap_used_pct", float64(swapPercentage), "%").Thresholds(c.swapWarnLevel, c.swapCritLevel).Bounds(0, 100),
+	)
+	if sampled {
+		status.AddPerfdata(
+			check.NewPerfdata("swap_in", swapIn, "").Thresholds(c.rateWarnLevel, c.rateCritLevel).Minimum(0).Metric("swap_pages", map[string]string{"direction": "in"}),
+			check.NewPerfdata("swap_out", swapOut, "").Thresholds(c.rateWarnLevel, c.rateCritLevel).Minimum(0).Metric("swap_pages", map[string]string{"direction": "out"}),
+		)
+	}
+	status.AddPerfdata(
+		check.NewPerfdata("hugepages_free", float64(info["HugePages_Free"]), "").Bounds(0, float64(info["HugePages_Total"])),
+		check.NewPerfdata("hugepages_total", float64(info["HugePages_Total"]), "").Minimum(0),
+	)
+	return status
+}
 
-	var total int
-	var available int
+// swapRate samples /proc/vmstat over the interval and returns the pages
+// swapped in and out per second.
+func (c *memCheck) swapRate() (float64, float64, error) {
+	before, err := c.readVmstat()
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	time.Sleep(c.interval)
+	after, err := c.readVmstat()
+	if err != nil {
+		return 0, 0, err
+	}
+	seconds := time.Since(start).Seconds()
+	swapIn := float64(after["pswpin"]-before["pswpin"]) / seconds
+	swapOut := float64(after["pswpout"]-before["pswpout"]) / seconds
+	return swapIn, swapOut, nil
+}
 
-	lines := strings.Split(result, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Mem:") {
-			total, _ = strconv.Atoi(strings.Fields(line)[1])
+func (c *memCheck) readVmstat() (map[string]int64, error) {
+	data, err := c.procfs.ReadProc("vmstat")
+	if err != nil {
+		return nil, err
+	}
+	vmstat := make(map[string]int64)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected vmstat line: %s", line)
 		}
-		if strings.HasPrefix(line, "-/+ buffers/cache") {
-			available, _ = strconv.Atoi(strings.Fields(line)[3])
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
 		}
+		vmstat[fields[0]] = value
 	}
+	return vmstat, nil
+}
 
-	availablePercentage := int(float64(available) / float64(total) * float64(100))
+// meminfo holds the /proc/meminfo fields, in kB for sizes and as plain
+// numbers for counts such as HugePages_Total.
+type meminfo map[string]int64
 
-	status := &nagios.NagiosStatus{}
+func parseMeminfo(data string) (meminfo, error) {
+	info := make(meminfo)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			return nil, fmt.Errorf("unexpected meminfo line: %s", line)
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return info, nil
+}
+
+// available returns MemAvailable. Kernels older than 3.14 do not have it,
+// so it is estimated as free memory plus the page cache and the reclaimable
+// slab, less shared memory which cannot be dropped.
+func (m meminfo) available() int64 {
+	if available, ok := m["MemAvailable"]; ok {
+		return available
+	}
+	available := m["MemFree"] + m["Buffers"] + m["Cached"] + m["SReclaimable"] - m["Shmem"]
 	switch {
-	case availablePercentage <= critLevel:
-		status.Value = nagios.NAGIOS_CRITICAL
-	case availablePercentage <= warnLevel:
-		status.Value = nagios.NAGIOS_WARNING
-	default:
-		status.Value = nagios.NAGIOS_OK
+	case available < m["MemFree"]:
+		return m["MemFree"]
+	case available > m["MemTotal"]:
+		return m["MemTotal"]
 	}
+	return available
+}
 
-	status.Message = fmt.Sprintf("Check Mem: total=%vmB available=%vmB | %v%% Available Memory left.", total, available, availablePercentage)
-	nagios.ExitWithStatus(status)
+func toMB(kb int64) int64 {
+	return kb / 1024
 }
@@ -0,0 +1,85 @@
+package mem
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+func newCheck(root string) *memCheck {
+	return &memCheck{
+		warnLevel: check.MustParseRange("30:"),
+		critLevel: check.MustParseRange("10:"),
+		procfs:    &check.Procfs{ProcRoot: root},
+	}
+}
+
+func TestRun(t *testing.T) {
+	status := newCheck("testdata/proc").Run()
+	if status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("expected WARNING, status is %v.", status)
+	}
+	expected := "Check Mem: total=8000mB available=1000mB, 12% Available Memory left.\n" +
+		"buffers=100mB cached=2000mB slab=300mB dirty=20mB hugepages=16/64\n" +
+		"swap=1024/2048mB, 50% used"
+	if status.Message != expected {
+		t.Errorf("expected %q, message is %q.", expected, status.Message)
+	}
+	perfdata := check.FormatPerfdata(status.Perfdata)
+	expected = "available_pct=12%;30:;10:;0;100 available=1000MB;;;0;8000 total=8000MB;;;0 buffers=100MB;;;0;8000 cached=2000MB;;;0;8000 slab=300MB;;;0;8000 dirty=20MB;;;0;8000 swap_used=1024MB;;;0;2048 swap_total=2048MB;;;0 swap_used_pct=50%;;;0;100 hugepages_free=16;;;0;64 hugepages_total=64;;;0"
+	if perfdata != expected {
+		t.Errorf("expected %q, perfdata is %q.", expected, perfdata)
+	}
+}
+
+func TestAvailableFallback(t *testing.T) {
+	status := newCheck("testdata/legacy/proc").Run()
+	// 400 free + 100 buffers + 900 cached + 100 reclaimable slab - 200 shmem
+	if status.Value != nagios.NAGIOS_OK || status.Perfdata[1].Value != 1300 {
+		t.Errorf("expected 1300mB available, status is %v.", status)
+	}
+}
+
+func TestSwapRateNotSampledWithoutLevels(t *testing.T) {
+	c := newCheck("testdata/proc")
+	c.interval = 500 * time.Millisecond
+	start := time.Now()
+	c.Run()
+	if elapsed := time.Since(start); elapsed >= c.interval {
+		t.Errorf("the swap rate should not be sampled without a level, run took %v.", elapsed)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if status := newCheck("testdata/missing").Run(); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("missing meminfo should be UNKNOWN, status is %v.", status)
+	}
+	if _, err := parseMeminfo("MemTotal: lots kB\n"); err == nil {
+		t.Error("non numeric meminfo should be an error.")
+	}
+}
+
+func TestSwapThresholds(t *testing.T) {
+	c := newCheck("testdata/proc")
+	c.warnLevel = nil
+	c.critLevel = nil
+	c.swapWarnLevel = check.MustParseRange("25")
+	c.swapCritLevel = check.MustParseRange("40")
+	if status := c.Run(); status.Value != nagios.NAGIOS_CRITICAL {
+		t.Errorf("50%% swap used should be CRITICAL, status is %v.", status)
+	}
+
+	c.swapCritLevel = nil
+	c.rateCritLevel = check.MustParseRange("0")
+	c.interval = 10 * time.Millisecond
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_WARNING || !strings.HasSuffix(status.Message, "0.00 pages/s in, 0.00 pages/s out") {
+		t.Errorf("expected WARNING, status is %v.", status)
+	}
+	if in, out := status.Perfdata[10], status.Perfdata[11]; in.Label != "swap_in" || in.Value != 0 || out.Value != 0 {
+		t.Errorf("swap rate of an unchanged vmstat should be 0, is %v and %v.", in.Value, out.Value)
+	}
+}
@@ -1,52 +1,137 @@
-package main
+package ntp
 
 import (
-	"bytes"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
-
-	"os/exec"
+	"time"
 
 	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
-var (
-	warnLevel = kingpin.Flag("warn-level", "warn level").Default("10").Float()
-	critLevel = kingpin.Flag("crit-level", "crit level").Default("100").Float()
-)
+// Definition is the ntp subcommand.
+var Definition = &check.Definition{
+	Name:     "ntp",
+	Help:     "Check the NTP clock offset.",
+	Register: register,
+}
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-	checkNtp(*warnLevel, *critLevel)
+type ntpCheck struct {
+	warnLevel        *check.Range
+	critLevel        *check.Range
+	delayWarnLevel   *check.Range
+	delayCritLevel   *check.Range
+	stratumWarnLevel *check.Range
+	stratumCritLevel *check.Range
+	server           string
+	timeout          time.Duration
 }
 
-func checkNtp(warnLevel, critLevel float64) {
-	cmd := exec.Command("ntpq", "-c", "rv 0 offset")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+func register(flags check.FlagSet) check.Check {
+	c := &ntpCheck{
+		warnLevel:        check.RangeFlag(flags.Flag("warn-level", "warn range for the offset in ms, a bare N or ~:N alerts beyond -N or N").Default("10")),
+		critLevel:        check.RangeFlag(flags.Flag("crit-level", "crit range for the offset in ms, a bare N or ~:N alerts beyond -N or N").Default("100")),
+		delayWarnLevel:   check.RangeFlag(flags.Flag("delay-warn-level", "warn range for the round trip delay to --server in ms")),
+		delayCritLevel:   check.RangeFlag(flags.Flag("delay-crit-level", "crit range for the round trip delay to --server in ms")),
+		stratumWarnLevel: check.RangeFlag(flags.Flag("stratum-warn-level", "warn range for the stratum of --server")),
+		stratumCritLevel: check.RangeFlag(flags.Flag("stratum-crit-level", "crit range for the stratum of --server")),
+	}
+	flags.Flag("server", "Query this NTP server, host or host:port, directly instead of the local ntpd through ntpq").StringVar(&c.server)
+	flags.Flag("timeout", "Time to wait for the reply of --server").Default("5s").DurationVar(&c.timeout)
+	return c
+}
+
+func (c *ntpCheck) Run() *check.Status {
+	warnLevel, critLevel := symmetric(c.warnLevel), symmetric(c.critLevel)
+	if c.server != "" {
+		return c.queryServer(warnLevel, critLevel)
+	}
+	out, err := check.NewCommand("ntpq", "-c", "rv 0 offset").Run()
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
 	}
-	result := strings.TrimSpace(out.String())
-	offset, err := strconv.ParseFloat(strings.Split(result, "=")[1], 64)
+	offset, err := parseNtpq(out)
 	if err != nil {
-		nagios.Unknown(err.Error())
+		return check.Unknown(err)
 	}
 
-	status := &nagios.NagiosStatus{}
+	status := &check.Status{}
+	status.Value = check.Evaluate(offset, warnLevel, critLevel)
+
+	status.Message = fmt.Sprintf("CheckNTP: Offset: %0.2f", offset)
+	status.AddPerfdata(check.NewPerfdata("offset", offset, "ms").Thresholds(warnLevel, critLevel))
+	return status
+}
+
+// symmetric turns an offset level such as 10 or ~:10 into -10:10, so that
+// the signed offset is evaluated, and reported in perfdata, against a level
+// that applies to both directions. Other ranges apply to the signed offset
+// as given.
+func symmetric(r *check.Range) *check.Range {
+	if !r.IsSet() || r.Inside || math.IsInf(r.End, 1) || (r.Start != 0 && !math.IsInf(r.Start, -1)) {
+		return r
+	}
+	end := strconv.FormatFloat(r.End, 'f', -1, 64)
+	s, err := check.ParseRange("-" + end + ":" + end)
+	if err != nil {
+		return r
+	}
+	return s
+}
+
+// parseNtpq reads the offset out of ntpq output such as "offset=0.521".
+func parseNtpq(out string) (float64, error) {
+	result := strings.TrimSpace(out)
+	parts := strings.SplitN(result, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) != "offset" {
+		return 0, fmt.Errorf("unexpected ntpq output: %q", result)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+}
+
+// queryServer checks the offset of the local clock against --server, and
+// the server itself.
+func (c *ntpCheck) queryServer(warnLevel, critLevel *check.Range) *check.Status {
+	r, err := query(c.server, c.timeout)
+	if err != nil {
+		return check.Unknown(err)
+	}
+	offset := toMs(r.offset)
+	delay := toMs(r.delay)
+
+	status := &check.Status{}
+	for _, state := range []nagios.NagiosStatusVal{
+		check.Evaluate(offset, warnLevel, critLevel),
+		check.Evaluate(delay, c.delayWarnLevel, c.delayCritLevel),
+		check.Evaluate(float64(r.stratum), c.stratumWarnLevel, c.stratumCritLevel),
+	} {
+		if state > status.Value {
+			status.Value = state
+		}
+	}
+
+	status.Message = fmt.Sprintf("CheckNTP: Offset: %0.2f, delay %0.2f ms, stratum %d, reference %s from %s", offset, delay, r.stratum, r.reference(), c.server)
 	switch {
-	case offset >= critLevel || offset <= -critLevel:
+	case r.stratum == 0:
 		status.Value = nagios.NAGIOS_CRITICAL
-	case offset >= warnLevel || offset <= -warnLevel:
-		status.Value = nagios.NAGIOS_WARNING
-	default:
-		status.Value = nagios.NAGIOS_OK
+		status.Message += fmt.Sprintf("\nServer sent kiss code %s.", r.reference())
+	case r.leap == leapAlarm || r.stratum >= stratumUnsynchronized:
+		status.Value = nagios.NAGIOS_CRITICAL
+		status.Message += "\nServer clock is not synchronized."
+	case r.leap != 0:
+		status.Message += "\nLeap second pending."
 	}
+	status.AddPerfdata(
+		check.NewPerfdata("offset", offset, "ms").Thresholds(warnLevel, critLevel),
+		check.NewPerfdata("delay", delay, "ms").Thresholds(c.delayWarnLevel, c.delayCritLevel).Minimum(0),
+		check.NewPerfdata("stratum", float64(r.stratum), "").Thresholds(c.stratumWarnLevel, c.stratumCritLevel).Bounds(0, stratumUnsynchronized),
+		check.NewPerfdata("leap", float64(r.leap), "").Bounds(0, leapAlarm),
+	)
+	return status
+}
 
-	status.Message = fmt.Sprintf("CheckNTP: Offset: %0.2f", offset)
-	nagios.ExitWithStatus(status)
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
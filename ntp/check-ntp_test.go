@@ -0,0 +1,123 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+// serve answers one NTP request on a local UDP port with a clock ahead of
+// ours by skew, and returns the server address.
+func serve(t *testing.T, skew time.Duration, leap, stratum byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer conn.Close()
+		request := make([]byte, packetSize)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+		received := time.Now().Add(skew)
+		reply := make([]byte, packetSize)
+		reply[0] = leap<<6 | version<<3 | modeServer
+		reply[1] = stratum
+		copy(reply[12:], []byte{192, 0, 2, 1})
+		copy(reply[24:], request[40:48])
+		binary.BigEndian.PutUint64(reply[32:], toNtpTime(received))
+		binary.BigEndian.PutUint64(reply[40:], toNtpTime(time.Now().Add(skew)))
+		conn.WriteTo(reply, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func newCheck(server string) *ntpCheck {
+	return &ntpCheck{
+		warnLevel: check.MustParseRange("10"),
+		critLevel: check.MustParseRange("100"),
+		server:    server,
+		timeout:   time.Second,
+	}
+}
+
+func TestQueryServer(t *testing.T) {
+	status := newCheck(serve(t, 50*time.Millisecond, 0, 2)).Run()
+	if status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("a 50ms offset should be WARNING, status is %v.", status)
+	}
+	offset, delay := status.Perfdata[0].Value, status.Perfdata[1].Value
+	if offset < 45 || offset > 55 || delay < 0 || delay > 10 {
+		t.Errorf("expected a 50ms offset and a small delay, got %v and %v.", offset, delay)
+	}
+	if !strings.Contains(status.Message, "stratum 2, reference 192.0.2.1") {
+		t.Errorf("unexpected message %q.", status.Message)
+	}
+}
+
+func TestQueryUnsynchronized(t *testing.T) {
+	status := newCheck(serve(t, 0, leapAlarm, stratumUnsynchronized)).Run()
+	if status.Value != nagios.NAGIOS_CRITICAL || !strings.HasSuffix(status.Message, "Server clock is not synchronized.") {
+		t.Errorf("an unsynchronized server should be CRITICAL, status is %v.", status)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := newCheck(conn.LocalAddr().String())
+	c.timeout = 50 * time.Millisecond
+	if status := c.Run(); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("a server that does not answer should be UNKNOWN, status is %v.", status)
+	}
+}
+
+func TestNtpTime(t *testing.T) {
+	now := time.Unix(1440587340, 123456789)
+	if back := fromNtpTime(toNtpTime(now)); back.Sub(now) > time.Microsecond || now.Sub(back) > time.Microsecond {
+		t.Errorf("expected %v back, got %v.", now, back)
+	}
+}
+
+func TestParseNtpq(t *testing.T) {
+	if offset, err := parseNtpq("offset=-0.521\n"); err != nil || offset != -0.521 {
+		t.Errorf("expected -0.521, got %v, %v.", offset, err)
+	}
+	if _, err := parseNtpq("ntpq: read: Connection refused\n"); err == nil {
+		t.Error("ntpq errors should not parse.")
+	}
+}
+
+func TestNegativeOffset(t *testing.T) {
+	status := newCheck(serve(t, -5*time.Millisecond, 0, 2)).Run()
+	if status.Value != nagios.NAGIOS_OK {
+		t.Errorf("a -5ms offset should be OK, status is %v.", status)
+	}
+	offset := status.Perfdata[0]
+	if offset.Warn.String() != "-10:10" || offset.Crit.String() != "-100:100" || offset.Warn.Alert(offset.Value) {
+		t.Errorf("perfdata should carry symmetric levels the offset is within, got %v.", check.FormatPerfdata(status.Perfdata[:1]))
+	}
+	if status := newCheck(serve(t, -50*time.Millisecond, 0, 2)).Run(); status.Value != nagios.NAGIOS_WARNING {
+		t.Errorf("a -50ms offset should be WARNING, status is %v.", status)
+	}
+}
+
+func TestSymmetric(t *testing.T) {
+	for spec, expected := range map[string]string{"10": "-10:10", "~:2.5": "-2.5:2.5", "-20:5": "-20:5", "@1:2": "@1:2", "5:": "5:"} {
+		if s := symmetric(check.MustParseRange(spec)); s.String() != expected {
+			t.Errorf("expected %s to read as %s, got %s.", spec, expected, s)
+		}
+	}
+	if symmetric(nil).IsSet() {
+		t.Error("an unset level should stay unset.")
+	}
+}
@@ -0,0 +1,135 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	packetSize = 48
+	// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to
+	// the unix epoch.
+	ntpEpochOffset = 2208988800
+
+	modeClient = 3
+	modeServer = 4
+	version    = 4
+
+	// leapAlarm is the leap indicator of a server whose clock is not
+	// synchronized.
+	leapAlarm = 3
+	// stratumUnsynchronized is the highest stratum, 0 being a kiss-o'-death
+	// packet.
+	stratumUnsynchronized = 16
+)
+
+// response is the reply of an NTP server to a client request.
+type response struct {
+	leap    int
+	stratum int
+	// refID is the reference of the server's clock: an address for
+	// stratum 2 and up, and a code such as GPS or a kiss code such as RATE
+	// otherwise
+	refID  [4]byte
+	offset time.Duration
+	delay  time.Duration
+}
+
+// query sends a client request to server, a host with an optional port,
+// and computes the clock offset and round trip delay from its reply as RFC
+// 5905 does.
+func query(server string, timeout time.Duration) (*response, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	request := make([]byte, packetSize)
+	request[0] = version<<3 | modeClient
+	sent := time.Now()
+	transmit := toNtpTime(sent)
+	binary.BigEndian.PutUint64(request[40:], transmit)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, packetSize)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return nil, err
+		}
+		received := time.Now()
+		if n < packetSize || binary.BigEndian.Uint64(reply[24:]) != transmit {
+			// not the reply to our request, keep waiting
+			continue
+		}
+		return parseResponse(reply, sent, received)
+	}
+}
+
+// parseResponse reads a server reply to a request sent and received at the
+// given local times.
+func parseResponse(reply []byte, sent, received time.Time) (*response, error) {
+	if mode := reply[0] & 0x7; mode != modeServer {
+		return nil, fmt.Errorf("unexpected NTP mode %d in reply", mode)
+	}
+	r := &response{
+		leap:    int(reply[0] >> 6),
+		stratum: int(reply[1]),
+	}
+	copy(r.refID[:], reply[12:16])
+
+	serverReceived := fromNtpTime(binary.BigEndian.Uint64(reply[32:]))
+	serverSent := fromNtpTime(binary.BigEndian.Uint64(reply[40:]))
+	if serverSent.Before(serverReceived) {
+		return nil, errors.New("NTP reply was sent before the request was received")
+	}
+	r.offset = (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	r.delay = received.Sub(sent) - serverSent.Sub(serverReceived)
+	if r.delay < 0 {
+		r.delay = 0
+	}
+	return r, nil
+}
+
+// reference renders the reference id the way ntpq does.
+func (r *response) reference() string {
+	if r.stratum < 2 {
+		return string(trimNul(r.refID[:]))
+	}
+	return net.IP(r.refID[:]).String()
+}
+
+func trimNul(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
+
+// toNtpTime converts t to a 64 bit NTP timestamp, seconds since 1900 in the
+// high 32 bits and their fraction in the low ones.
+func toNtpTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+func fromNtpTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanoseconds := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanoseconds)
+}
@@ -1,156 +1,308 @@
-package main
+package proc
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"regexp"
 	"strconv"
 	"strings"
 
 	"io/ioutil"
-	"os/exec"
 
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
-	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+	"github.com/AcalephStorage/go_check/check"
 )
 
 type procMap map[string]string
 type procMaps []procMap
-type rejectFunc func(p procMap) bool
-
-var (
-	warnOver    = kingpin.Flag("warn-over", "Trigger a warning if over a number").Int()
-	critOver    = kingpin.Flag("crit-over", "Trigger critical if over a number").Int()
-	warnUnder   = kingpin.Flag("warn-under", "Trigger a warning if under a number").Default("1").Int()
-	critUnder   = kingpin.Flag("crit-under", "Trigger critical if under a number").Default("1").Int()
-	metric      = kingpin.Flag("metric", "Trigger critical if there are metric procs").String()
-	matchSelf   = kingpin.Flag("match-self", "Match itself").Bool()
-	matchParent = kingpin.Flag("match-parent", "Match parent").Bool()
-	pattern     = kingpin.Flag("pattern", "Match a command against this pattern").String()
-	filePid     = kingpin.Flag("file-pid", "Check against a specific PID").String()
-	vsz         = kingpin.Flag("virtual-memory-size", "Trigger on a Virtual Memory size is bigger than this").Int64()
-	rss         = kingpin.Flag("resident-set-size", "Trigger on a Resident Set size is bigger than this").Int64()
-	pcpu        = kingpin.Flag("proportional-set-size", "Trigger on a Proportional Set Size is bigger than this").Float()
-	threadCount = kingpin.Flag("thread-count", "Trigger on a Thread Count is bigger than this").Int()
-	state       = kingpin.Flag("state", "Trigger on a specific state, example: Z for zombie").String()
-	user        = kingpin.Flag("user", "Trigger on a specific user").String()
-	esecOver    = kingpin.Flag("esec-over", "Match processes that older that this, in SECONDS").Int()
-	esecUnder   = kingpin.Flag("esec-under", "Match process that are younger than this, in SECONDS").Int()
-	cpuOver     = kingpin.Flag("cpu-over", "Match processes cpu time that is older than this, in SECONDS").Int()
-	cpuUnder    = kingpin.Flag("cpu-under", "Match processes cpu time that is younger than this, in SECONDS").Int()
-)
+type rejectFunc func(p procMap) (bool, error)
 
-func main() {
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
-
-	procs := getProcs()
-	procs.filterPid(*filePid)
-	procs.filterSelf(*matchSelf)
-	procs.filterPattern(*pattern)
-	procs.filterVsz(*vsz)
-	procs.filterRss(*rss)
-	procs.filterPcpu(*pcpu)
-	procs.filterThreadCount(*threadCount)
-	procs.filterEsecUnder(*esecUnder)
-	procs.filterEsecOver(*esecOver)
-	procs.filterCpuUnder(*cpuUnder)
-	procs.filterCpuOver(*cpuOver)
-	procs.filterState(*state)
-	procs.filterUser(*user)
-
-	count, message := procs.summary()
-
-	status := &nagios.NagiosStatus{}
-	switch {
-	case *critUnder != 0 && count < *critUnder:
-		status.Value = nagios.NAGIOS_CRITICAL
-	case *critOver != 0 && count > *critOver:
-		status.Value = nagios.NAGIOS_CRITICAL
-	case *warnUnder != 0 && count < *warnUnder:
-		status.Value = nagios.NAGIOS_WARNING
-	case *warnOver != 0 && count > *warnOver:
-		status.Value = nagios.NAGIOS_WARNING
-	default:
-		status.Value = nagios.NAGIOS_OK
+// Definition is the proc subcommand.
+var Definition = &check.Definition{
+	Name:     "proc",
+	Help:     "Check the number of processes matching a set of filters.",
+	Register: register,
+}
+
+type procCheck struct {
+	warnOver    int
+	critOver    int
+	warnUnder   int
+	critUnder   int
+	warnLevel   *check.Range
+	critLevel   *check.Range
+	metric      string
+	matchSelf   bool
+	matchParent bool
+	pattern     string
+	filePid     string
+	vsz         int64
+	rss         int64
+	pcpu        float64
+	threadCount int
+	state       string
+	user        string
+	esecOver    int
+	esecUnder   int
+	cpuOver     int
+	cpuUnder    int
+	procfs      *check.Procfs
+}
+
+func register(flags check.FlagSet) check.Check {
+	c := &procCheck{}
+	flags.Flag("warn-over", "Trigger a warning if over a number").IntVar(&c.warnOver)
+	flags.Flag("crit-over", "Trigger critical if over a number").IntVar(&c.critOver)
+	flags.Flag("warn-under", "Trigger a warning if under a number").Default("1").IntVar(&c.warnUnder)
+	flags.Flag("crit-under", "Trigger critical if under a number").Default("1").IntVar(&c.critUnder)
+	c.warnLevel = check.RangeFlag(flags.Flag("warn-level", "Warn range for the number of processes, overrides warn-over and warn-under"))
+	c.critLevel = check.RangeFlag(flags.Flag("crit-level", "Critical range for the number of processes, overrides crit-over and crit-under"))
+	flags.Flag("metric", "Trigger critical if there are metric procs").StringVar(&c.metric)
+	flags.Flag("match-self", "Match itself").BoolVar(&c.matchSelf)
+	flags.Flag("match-parent", "Match parent").BoolVar(&c.matchParent)
+	flags.Flag("pattern", "Match a command against this pattern").StringVar(&c.pattern)
+	flags.Flag("file-pid", "Check against a specific PID").StringVar(&c.filePid)
+	flags.Flag("virtual-memory-size", "Trigger on a Virtual Memory size is bigger than this").Int64Var(&c.vsz)
+	flags.Flag("resident-set-size", "Trigger on a Resident Set size is bigger than this").Int64Var(&c.rss)
+	flags.Flag("proportional-set-size", "Trigger on a Proportional Set Size is bigger than this").FloatVar(&c.pcpu)
+	flags.Flag("thread-count", "Trigger on a Thread Count is bigger than this").IntVar(&c.threadCount)
+	flags.Flag("state", "Trigger on a specific state, example: Z for zombie").StringVar(&c.state)
+	flags.Flag("user", "Trigger on a specific user").StringVar(&c.user)
+	flags.Flag("esec-over", "Match processes that older that this, in SECONDS").IntVar(&c.esecOver)
+	flags.Flag("esec-under", "Match process that are younger than this, in SECONDS").IntVar(&c.esecUnder)
+	flags.Flag("cpu-over", "Match processes cpu time that is older than this, in SECONDS").IntVar(&c.cpuOver)
+	flags.Flag("cpu-under", "Match processes cpu time that is younger than this, in SECONDS").IntVar(&c.cpuUnder)
+	c.procfs = check.ProcfsFlags(flags)
+	return c
+}
+
+func (c *procCheck) Run() *check.Status {
+	procs, err := readProcs(c.procfs)
+	if err != nil {
+		return check.Unknown(err)
 	}
+	if err := c.filter(&procs); err != nil {
+		return check.Unknown(err)
+	}
+
+	count, message := c.summary(procs)
+
+	warn := c.warnLevel
+	if !warn.IsSet() {
+		if warn, err = countRange(c.warnUnder, c.warnOver); err != nil {
+			return check.Unknown(err)
+		}
+	}
+	crit := c.critLevel
+	if !crit.IsSet() {
+		if crit, err = countRange(c.critUnder, c.critOver); err != nil {
+			return check.Unknown(err)
+		}
+	}
+
+	status := &check.Status{}
+	status.Value = check.Evaluate(float64(count), warn, crit)
 	status.Message = message
-	nagios.ExitWithStatus(status)
+	status.AddPerfdata(check.NewPerfdata("procs", float64(count), "").Thresholds(warn, crit).Minimum(0))
+	return status
 }
 
-func getProcs() procMaps {
-	lines := readLines("ps axwwo user,pid,vsz,rss,pcpu,nlwp,state,etime,time,command")
-	procs := make(procMaps, len(lines))
-	for i, line := range lines {
-		proc := toMap(line, "user", "pid", "vsz", "rss", "pcpu", "nlwp", "state", "etime", "time", "command")
-		procs[i] = proc
+func (c *procCheck) filter(procs *procMaps) error {
+	if err := procs.filterPid(c.filePid); err != nil {
+		return err
+	}
+	if err := procs.filterSelf(c.matchSelf); err != nil {
+		return err
+	}
+	if err := procs.filterPattern(c.pattern); err != nil {
+		return err
 	}
-	return procs
+	if err := procs.filterVsz(c.vsz); err != nil {
+		return err
+	}
+	if err := procs.filterRss(c.rss); err != nil {
+		return err
+	}
+	if err := procs.filterPcpu(c.pcpu); err != nil {
+		return err
+	}
+	if err := procs.filterThreadCount(c.threadCount); err != nil {
+		return err
+	}
+	procs.filterEsecUnder(c.esecUnder)
+	procs.filterEsecOver(c.esecOver)
+	procs.filterCpuUnder(c.cpuUnder)
+	procs.filterCpuOver(c.cpuOver)
+	procs.filterState(c.state)
+	procs.filterUser(c.user)
+	return nil
 }
 
-func readLines(command string) []string {
-	cmdArr := strings.Split(command, " ")
-	cmd := exec.Command(cmdArr[0], cmdArr[1:]...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err := cmd.Run(); err != nil {
-		nagios.Unknown(err.Error())
+// countRange converts the under/over flags into a threshold range.
+func countRange(under, over int) (*check.Range, error) {
+	switch {
+	case under == 0 && over == 0:
+		return check.ParseRange("")
+	case over == 0:
+		return check.ParseRange(fmt.Sprintf("%d:", under))
+	default:
+		return check.ParseRange(fmt.Sprintf("%d:%d", under, over))
 	}
-	lines := out.String()
+}
 
-	lineArr := strings.Split(lines, "\n")
-	if len(lineArr) > 1 {
-		return lineArr[1 : len(lineArr)-1]
-	} else {
-		return []string{}
+// clockTicks is USER_HZ, the unit of the times in /proc/<pid>/stat, which
+// is 100 on every architecture Linux supports.
+const clockTicks = 100
+
+// readProcs builds the process table out of /proc/<pid>, with the columns
+// of ps axwwo user,pid,vsz,rss,pcpu,nlwp,state,etime,time,command.
+func readProcs(procfs *check.Procfs) (procMaps, error) {
+	uptimeData, err := procfs.ReadProc("uptime")
+	if err != nil {
+		return nil, err
+	}
+	uptimeFields := strings.Fields(uptimeData)
+	if len(uptimeFields) == 0 {
+		return nil, fmt.Errorf("unexpected uptime: %q", uptimeData)
+	}
+	uptime, err := strconv.ParseFloat(uptimeFields[0], 64)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(procfs.Proc())
+	if err != nil {
+		return nil, err
+	}
+	procs := make(procMaps, 0, len(entries))
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		proc, err := readProc(procfs, entry.Name(), uptime)
+		if os.IsNotExist(err) {
+			// the process exited since the directory was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		procs = append(procs, proc)
 	}
+	return procs, nil
 }
 
-func toMap(line string, keys ...string) procMap {
-	ps := make(procMap)
-
-	rxp := regexp.MustCompile("\\ +")
-	lineArr := rxp.Split(line, 10)
+// readProc reads the stat, status and cmdline of a process.
+func readProc(procfs *check.Procfs, pid string, uptime float64) (procMap, error) {
+	stat, err := procfs.ReadProc(pid, "stat")
+	if err != nil {
+		return nil, err
+	}
+	status, err := procfs.ReadProc(pid, "status")
+	if err != nil {
+		return nil, err
+	}
+	cmdline, err := procfs.ReadProc(pid, "cmdline")
+	if err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < len(lineArr); i++ {
-		key := keys[i]
-		val := lineArr[i]
-		ps[key] = val
+	// the command name is in parentheses and may itself contain spaces and
+	// parentheses, the fields after it are counted from the state, field 3
+	open, closing := strings.Index(stat, "("), strings.LastIndex(stat, ")")
+	if open < 0 || closing < open {
+		return nil, fmt.Errorf("unexpected stat of process %s: %q", pid, stat)
+	}
+	comm := stat[open+1 : closing]
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("unexpected stat of process %s: %q", pid, stat)
+	}
+	stats := make(map[int]int64)
+	for _, field := range []int{14, 15, 20, 22, 23, 24} {
+		if stats[field], err = strconv.ParseInt(fields[field-3], 10, 64); err != nil {
+			return nil, fmt.Errorf("unexpected stat of process %s: %v", pid, err)
+		}
 	}
+	cpuSeconds := int((stats[14] + stats[15]) / clockTicks)
+	elapsed := uptime - float64(stats[22])/clockTicks
+	pcpu := 0.0
+	if elapsed > 0 {
+		pcpu = float64(stats[14]+stats[15]) / clockTicks / elapsed * 100
+	}
+
+	command := strings.TrimSpace(strings.Replace(cmdline, "\x00", " ", -1))
+	if command == "" {
+		// kernel threads have no command line
+		command = "[" + comm + "]"
+	}
+
+	return procMap{
+		"user":    processUser(status),
+		"pid":     pid,
+		"vsz":     strconv.FormatInt(stats[23]/1024, 10),
+		"rss":     strconv.FormatInt(stats[24]*int64(os.Getpagesize())/1024, 10),
+		"pcpu":    strconv.FormatFloat(pcpu, 'f', 1, 64),
+		"nlwp":    strconv.FormatInt(stats[20], 10),
+		"state":   fields[0],
+		"etime":   formatTime(int(elapsed)),
+		"time":    formatTime(cpuSeconds),
+		"command": command,
+	}, nil
+}
 
-	return ps
+// processUser returns the name of the real user of a process, or its uid
+// when it has no name here, as for the users of a host seen from a
+// container.
+func processUser(status string) string {
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "Uid:" {
+			continue
+		}
+		if u, err := user.LookupId(fields[1]); err == nil {
+			return u.Username
+		}
+		return fields[1]
+	}
+	return ""
 }
 
-func readPid(filePid string) int64 {
-	if filePid == "" {
-		return 0
+// formatTime renders seconds the way ps does, as [dd-]hh:mm:ss.
+func formatTime(seconds int) string {
+	if seconds < 0 {
+		seconds = 0
 	}
+	days, hours, minutes := seconds/86400, seconds/3600%24, seconds/60%60
+	if days > 0 {
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, minutes, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds%60)
+}
 
-	if _, err := os.Stat(filePid); err != nil {
-		nagios.Unknown("could not read pid file " + filePid)
+func readPid(filePid string) (int64, error) {
+	if filePid == "" {
+		return 0, nil
 	}
 
 	dat, err := ioutil.ReadFile(filePid)
 	if err != nil {
-		nagios.Unknown("could not read pid file " + filePid)
+		return 0, errors.New("could not read pid file " + filePid)
 	}
 
 	pidStr := strings.TrimSpace(string(dat))
 	pid, err := strconv.ParseInt(pidStr, 10, 64)
 	if err != nil {
-		nagios.Unknown("could not read pid file " + filePid)
+		return 0, errors.New("could not read pid file " + filePid)
 	}
 
-	return pid
+	return pid, nil
 }
 
+var timeRxp = regexp.MustCompile("((\\d+)-)?((\\d\\d):)?(\\d\\d):(\\d\\d)")
+
 func timeToSec(etime string) int {
-	rxp, err := regexp.Compile("((\\d+)-)?((\\d\\d):)?(\\d\\d):(\\d\\d)")
-	if err != nil {
-		nagios.Unknown(err.Error())
-	}
-	matches := rxp.FindStringSubmatch(etime)
+	matches := timeRxp.FindStringSubmatch(etime)
 	multipier := []int{0, 0, 86400, 0, 3600, 60, 1}
 	seconds := 0
 	for i, match := range matches {
@@ -161,201 +313,194 @@ func timeToSec(etime string) int {
 	return seconds
 }
 
-func (pms *procMaps) reject(rf rejectFunc) {
+func (pms *procMaps) reject(rf rejectFunc) error {
 	newPms := make(procMaps, 0)
 	for _, pm := range *pms {
-		if !rf(pm) {
+		rejected, err := rf(pm)
+		if err != nil {
+			return err
+		}
+		if !rejected {
 			newPms = append(newPms, pm)
 		}
 	}
 	*pms = newPms
+	return nil
 }
 
-func (pms *procMaps) filterPid(filePid string) {
-	if filePid := readPid(filePid); filePid != 0 {
-		pms.reject(func(p procMap) bool {
-			if pid, err := strconv.ParseInt(p["pid"], 10, 64); err != nil {
-				nagios.Unknown(err.Error())
-			} else {
-				return pid == filePid
-			}
-			return false
-		})
+func (pms *procMaps) filterPid(filePid string) error {
+	filePidVal, err := readPid(filePid)
+	if err != nil || filePidVal == 0 {
+		return err
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		pid, err := strconv.ParseInt(p["pid"], 10, 64)
+		return pid == filePidVal, err
+	})
 }
 
-func (pms *procMaps) filterSelf(matchSelf bool) {
-	if !matchSelf {
-		pms.reject(func(p procMap) bool {
-			procPid, err := strconv.Atoi(p["pid"])
-			if err != nil {
-				nagios.Unknown(err.Error())
-			}
-			pid := os.Getpid()
-			return procPid == pid
-		})
+func (pms *procMaps) filterSelf(matchSelf bool) error {
+	if matchSelf {
+		return nil
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		procPid, err := strconv.Atoi(p["pid"])
+		return procPid == os.Getpid(), err
+	})
 }
 
-func (pms *procMaps) filterPattern(pattern string) {
-	if pattern != "" {
-		rxp, err := regexp.Compile(pattern)
-		if err != nil {
-			nagios.Unknown(err.Error())
-		}
-		pms.reject(func(p procMap) bool {
-			return !rxp.MatchString(p["command"])
-		})
+func (pms *procMaps) filterPattern(pattern string) error {
+	if pattern == "" {
+		return nil
 	}
+	rxp, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	return pms.reject(func(p procMap) (bool, error) {
+		return !rxp.MatchString(p["command"]), nil
+	})
 }
 
-func (pms *procMaps) filterVsz(vsz int64) {
-	if vsz > 0 {
-		pms.reject(func(p procMap) bool {
-			procVsz, err := strconv.ParseInt(p["vsz"], 10, 64)
-			if err != nil {
-				nagios.Unknown(err.Error())
-			}
-			return procVsz > vsz
-		})
+func (pms *procMaps) filterVsz(vsz int64) error {
+	if vsz <= 0 {
+		return nil
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		procVsz, err := strconv.ParseInt(p["vsz"], 10, 64)
+		return procVsz > vsz, err
+	})
 }
 
-func (pms *procMaps) filterRss(rss int64) {
-	if rss > 0 {
-		pms.reject(func(p procMap) bool {
-			procRss, err := strconv.ParseInt(p["rss"], 10, 64)
-			if err != nil {
-				nagios.Unknown(err.Error())
-			}
-			return procRss > rss
-		})
+func (pms *procMaps) filterRss(rss int64) error {
+	if rss <= 0 {
+		return nil
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		procRss, err := strconv.ParseInt(p["rss"], 10, 64)
+		return procRss > rss, err
+	})
 }
 
-func (pms *procMaps) filterPcpu(pcpu float64) {
-	if pcpu > 0 {
-		pms.reject(func(p procMap) bool {
-			procPcpu, err := strconv.ParseFloat(p["pcpu"], 64)
-			if err != nil {
-				nagios.Unknown(err.Error())
-			}
-			return procPcpu > pcpu
-		})
+func (pms *procMaps) filterPcpu(pcpu float64) error {
+	if pcpu <= 0 {
+		return nil
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		procPcpu, err := strconv.ParseFloat(p["pcpu"], 64)
+		return procPcpu > pcpu, err
+	})
 }
 
-func (pms *procMaps) filterThreadCount(threadCount int) {
-	if threadCount > 0 {
-		pms.reject(func(p procMap) bool {
-			procTc, err := strconv.Atoi(p["thcount"])
-			if err != nil {
-				nagios.Unknown(err.Error())
-			}
-			return procTc > threadCount
-		})
+func (pms *procMaps) filterThreadCount(threadCount int) error {
+	if threadCount <= 0 {
+		return nil
 	}
+	return pms.reject(func(p procMap) (bool, error) {
+		procTc, err := strconv.Atoi(p["nlwp"])
+		return procTc > threadCount, err
+	})
 }
 
 func (pms *procMaps) filterEsecUnder(esecUnder int) {
 	if esecUnder > 0 {
-		pms.reject(func(p procMap) bool {
+		pms.reject(func(p procMap) (bool, error) {
 			procEsec := timeToSec(p["etime"])
-			return procEsec >= esecUnder
+			return procEsec >= esecUnder, nil
 		})
 	}
 }
 
 func (pms *procMaps) filterEsecOver(esecOver int) {
 	if esecOver > 0 {
-		pms.reject(func(p procMap) bool {
+		pms.reject(func(p procMap) (bool, error) {
 			procEsec := timeToSec(p["etime"])
-			return procEsec <= esecOver
+			return procEsec <= esecOver, nil
 		})
 	}
 }
 
 func (pms *procMaps) filterCpuUnder(cpuUnder int) {
 	if cpuUnder > 0 {
-		pms.reject(func(p procMap) bool {
+		pms.reject(func(p procMap) (bool, error) {
 			procCsec := timeToSec(p["time"])
-			return procCsec >= cpuUnder
+			return procCsec >= cpuUnder, nil
 		})
 	}
 }
 
 func (pms *procMaps) filterCpuOver(cpuOver int) {
 	if cpuOver > 0 {
-		pms.reject(func(p procMap) bool {
+		pms.reject(func(p procMap) (bool, error) {
 			procCsec := timeToSec(p["time"])
-			return procCsec <= cpuOver
+			return procCsec <= cpuOver, nil
 		})
 	}
 }
 
 func (pms *procMaps) filterState(state string) {
 	if state != "" {
-		pms.reject(func(p procMap) bool {
-			return !strings.Contains(state, p["state"])
+		pms.reject(func(p procMap) (bool, error) {
+			return !strings.Contains(state, p["state"]), nil
 		})
 	}
 }
 
 func (pms *procMaps) filterUser(user string) {
 	if user != "" {
-		pms.reject(func(p procMap) bool {
-			return !strings.Contains(user, p["user"])
+		pms.reject(func(p procMap) (bool, error) {
+			return !strings.Contains(user, p["user"]), nil
 		})
 	}
 }
 
-func (pms *procMaps) summary() (count int, msg string) {
-	msg = fmt.Sprintf("Found %d matching processes", len(*pms))
-	if *pattern != "" {
-		msg += fmt.Sprintf("; cmd /%s/", *pattern)
+func (c *procCheck) summary(pms procMaps) (count int, msg string) {
+	msg = fmt.Sprintf("Found %d matching processes", len(pms))
+	if c.pattern != "" {
+		msg += fmt.Sprintf("; cmd /%s/", c.pattern)
 	}
-	if *state != "" {
-		msg += fmt.Sprintf("; state %s", *state)
+	if c.state != "" {
+		msg += fmt.Sprintf("; state %s", c.state)
 	}
-	if *user != "" {
-		msg += fmt.Sprintf("; user %s", *user)
+	if c.user != "" {
+		msg += fmt.Sprintf("; user %s", c.user)
 	}
-	if *vsz > 0 {
-		msg += fmt.Sprintf("; vsz < %d", *vsz)
+	if c.vsz > 0 {
+		msg += fmt.Sprintf("; vsz < %d", c.vsz)
 	}
-	if *rss > 0 {
-		msg += fmt.Sprintf("; rss < %d", *rss)
+	if c.rss > 0 {
+		msg += fmt.Sprintf("; rss < %d", c.rss)
 	}
-	if *pcpu > 0 {
-		msg += fmt.Sprintf("; pcpu < %0.1f", *pcpu)
+	if c.pcpu > 0 {
+		msg += fmt.Sprintf("; pcpu < %0.1f", c.pcpu)
 	}
-	if *threadCount > 0 {
-		msg += fmt.Sprintf("; thcount < %d", *threadCount)
+	if c.threadCount > 0 {
+		msg += fmt.Sprintf("; thcount < %d", c.threadCount)
 	}
-	if *esecUnder > 0 {
-		msg += fmt.Sprintf("; esec < %d", *esecUnder)
+	if c.esecUnder > 0 {
+		msg += fmt.Sprintf("; esec < %d", c.esecUnder)
 	}
-	if *esecOver > 0 {
-		msg += fmt.Sprintf("; esec > %d", *esecOver)
+	if c.esecOver > 0 {
+		msg += fmt.Sprintf("; esec > %d", c.esecOver)
 	}
-	if *cpuUnder > 0 {
-		msg += fmt.Sprintf("; csec < %d", *cpuUnder)
+	if c.cpuUnder > 0 {
+		msg += fmt.Sprintf("; csec < %d", c.cpuUnder)
 	}
-	if *cpuOver > 0 {
-		msg += fmt.Sprintf("; csec > %d", *cpuOver)
+	if c.cpuOver > 0 {
+		msg += fmt.Sprintf("; csec > %d", c.cpuOver)
 	}
-	if *filePid != "" {
-		msg += fmt.Sprintf("; pid %s", *filePid)
+	if c.filePid != "" {
+		msg += fmt.Sprintf("; pid %s", c.filePid)
 	}
 
-	if *metric != "" {
-		for _, p := range *pms {
-			if val, err := strconv.Atoi(p[*metric]); err == nil {
+	if c.metric != "" {
+		for _, p := range pms {
+			if val, err := strconv.Atoi(p[c.metric]); err == nil {
 				count += val
 			}
 		}
 	} else {
-		count = len(*pms)
+		count = len(pms)
 	}
 	return
 }
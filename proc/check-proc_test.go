@@ -0,0 +1,86 @@
+package proc
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/AcalephStorage/go_check/Godeps/_workspace/src/github.com/newrelic/go_nagios"
+	"github.com/AcalephStorage/go_check/check"
+)
+
+var fixture = &check.Procfs{ProcRoot: "testdata/proc", SysRoot: "testdata/sys"}
+
+func TestReadProcs(t *testing.T) {
+	procs, err := readProcs(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 5 {
+		t.Fatalf("expected 5 processes, got %d: %v.", len(procs), procs)
+	}
+	byPid := make(map[string]procMap)
+	for _, p := range procs {
+		byPid[p["pid"]] = p
+	}
+
+	nginx := byPid["812"]
+	expected := procMap{
+		"user":    "4242",
+		"pid":     "812",
+		"vsz":     "51200",
+		"rss":     strconv.Itoa(2560 * os.Getpagesize() / 1024),
+		"pcpu":    "50.5",
+		"nlwp":    "4",
+		"state":   "S",
+		"etime":   "00:01:39",
+		"time":    "00:00:50",
+		"command": "nginx: worker process",
+	}
+	for key, value := range expected {
+		if nginx[key] != value {
+			t.Errorf("expected %s %q, got %q.", key, value, nginx[key])
+		}
+	}
+	if init := byPid["1"]; init["command"] != "/sbin/init splash" || init["time"] != "00:00:08" {
+		t.Errorf("unexpected init process %v.", init)
+	}
+	if kthreadd := byPid["2"]; kthreadd["command"] != "[kthreadd]" {
+		t.Errorf("kernel threads should be named after their comm, got %q.", kthreadd["command"])
+	}
+	if tmux := byPid["900"]; tmux["state"] != "S" || tmux["etime"] != "00:08:19" {
+		t.Errorf("a comm with parentheses should not shift the fields, got %v.", tmux)
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := &procCheck{warnUnder: 1, critUnder: 1, warnOver: 1, critOver: 2, pattern: "^nginx", procfs: fixture}
+	status := c.Run()
+	if status.Value != nagios.NAGIOS_OK {
+		t.Errorf("expected OK, status is %v.", status)
+	}
+	expected := "OK: Found 1 matching processes; cmd /^nginx/ | procs=1;1:1;1:2;0"
+	if status.String() != expected {
+		t.Errorf("expected %q, output is %q.", expected, status.String())
+	}
+
+	c = &procCheck{critUnder: 1, state: "Z", procfs: fixture}
+	if status := c.Run(); status.Value != nagios.NAGIOS_OK || status.Perfdata[0].Value != 1 {
+		t.Errorf("expected the zombie to be found, status is %v.", status)
+	}
+}
+
+func TestRunMissingProcRoot(t *testing.T) {
+	c := &procCheck{critUnder: 1, procfs: &check.Procfs{ProcRoot: "testdata/missing"}}
+	if status := c.Run(); status.Value != nagios.NAGIOS_UNKNOWN {
+		t.Errorf("expected UNKNOWN, status is %v.", status)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	for seconds, expected := range map[int]string{0: "00:00:00", 99: "00:01:39", 90061: "1-01:01:01"} {
+		if formatTime(seconds) != expected || timeToSec(expected) != seconds {
+			t.Errorf("expected %d seconds to read as %s, got %s.", seconds, expected, formatTime(seconds))
+		}
+	}
+}